@@ -0,0 +1,134 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ActiveTokenSet issues several tokens per session, e.g. one per browser tab, and keeps track of the last ones issued,
+// so only they are valid. Tokens are kept in memory, in a single process. ActiveTokenSet is safe for concurrent use.
+type ActiveTokenSet struct {
+	config *TokenConfig
+	secret string
+	ttl    time.Duration
+	max    int
+
+	mu sync.Mutex
+	// sessions holds the active tokens of every session, the oldest first
+	sessions map[string][]activeToken
+	// issued numbers the issued tokens, so the tokens issued for a session within a second are distinct
+	issued uint64
+	// nextSweep is when Issue next drops the expired tokens of all sessions
+	nextSweep time.Time
+}
+
+type activeToken struct {
+	token, nonce string
+	expiresAt    time.Time
+}
+
+// NewActiveTokenSet creates an ActiveTokenSet for the config (nil for the default one) and the secret, issuing tokens
+// valid for ttl and keeping up to max active tokens per session, at least one.
+func NewActiveTokenSet(config *TokenConfig, secret string, ttl time.Duration, max int) *ActiveTokenSet {
+	if config == nil {
+		config = defaultConfig
+	}
+	if max < 1 {
+		max = 1
+	}
+
+	return &ActiveTokenSet{config: config, secret: secret, ttl: ttl, max: max, sessions: make(map[string][]activeToken)}
+}
+
+// Issue issues a new token for the session. When the session already has max active tokens, the oldest one is evicted
+// and no longer valid. Expired tokens of the session are dropped, and those of all sessions at most once per ttl,
+// so the sessions that stopped using their tokens don't stay in memory.
+func (s *ActiveTokenSet) Issue(sessionId string) string {
+	now := s.config.now()
+	expireAt := now.Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.issued++
+	nonce := strconv.FormatUint(s.issued, 10)
+	token := s.config.GenerateTokenNonce(sessionId, nonce, expireAt, s.secret)
+
+	if !now.Before(s.nextSweep) {
+		for id := range s.sessions {
+			s.prune(id, now)
+		}
+		s.nextSweep = now.Add(s.ttl)
+	}
+
+	active := append(s.prune(sessionId, now), activeToken{token: token, nonce: nonce, expiresAt: expireAt})
+	if len(active) > s.max {
+		active = active[len(active)-s.max:]
+	}
+	s.sessions[sessionId] = active
+
+	return token
+}
+
+// Validate checks if the token is one of the active tokens of the session and is valid, like ValidateToken.
+// Every active token is compared, like every secret in Manager.Validate.
+func (s *ActiveTokenSet) Validate(sessionId, token string) bool {
+	now := s.config.now()
+
+	s.mu.Lock()
+	nonce, found := "", false
+	for _, t := range s.prune(sessionId, now) {
+		if TokensEqual(t.token, token) {
+			nonce, found = t.nonce, true
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		return false
+	}
+
+	return s.config.ValidateTokenNonce(token, sessionId, nonce, now, s.secret)
+}
+
+// prune drops the expired tokens of the session, and the session itself when none is left, returning the active ones.
+// s.mu must be held.
+func (s *ActiveTokenSet) prune(sessionId string, now time.Time) []activeToken {
+	tokens := s.sessions[sessionId]
+	active := tokens[:0]
+	for _, t := range tokens {
+		if !t.expiresAt.Before(now) {
+			active = append(active, t)
+		}
+	}
+	// clears the references to the dropped tokens
+	clear(tokens[len(active):])
+
+	if len(active) == 0 {
+		delete(s.sessions, sessionId)
+		return nil
+	}
+	s.sessions[sessionId] = active
+
+	return active
+}
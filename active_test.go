@@ -0,0 +1,105 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveTokenSetEvictsOldestToken(t *testing.T) {
+	sessionId := "user1-login"
+	set := NewActiveTokenSet(nil, "LoremIpsum123", time.Minute, 3)
+
+	tokens := make([]string, 4)
+	for i := range tokens {
+		tokens[i] = set.Issue(sessionId)
+	}
+
+	if set.Validate(sessionId, tokens[0]) {
+		t.Errorf("evicted token was expected to be invalid")
+	}
+	for i, token := range tokens[1:] {
+		if !set.Validate(sessionId, token) {
+			t.Errorf("active token %d was expected to be valid", i+1)
+		}
+	}
+	if set.Validate("user2-login", tokens[3]) {
+		t.Errorf("token was expected to be invalid for another session")
+	}
+}
+
+func TestActiveTokenSetRejectsTokensItDidNotIssue(t *testing.T) {
+	sessionId := "user1-login"
+	set := NewActiveTokenSet(nil, "LoremIpsum123", time.Minute, 3)
+	set.Issue(sessionId)
+
+	if set.Validate(sessionId, GenerateToken(sessionId, time.Now().Add(time.Minute), "LoremIpsum123")) {
+		t.Errorf("token not issued by the set was expected to be invalid")
+	}
+}
+
+func TestActiveTokenSetRejectsExpiredTokens(t *testing.T) {
+	sessionId := "user1-login"
+	clock := &FixedClock{Time: time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)}
+	set := NewActiveTokenSet(&TokenConfig{Clock: clock}, "LoremIpsum123", time.Minute, 3)
+	token := set.Issue(sessionId)
+
+	clock.Time = clock.Time.Add(2 * time.Minute)
+	if set.Validate(sessionId, token) {
+		t.Errorf("expired token was expected to be invalid")
+	}
+
+	set.Issue(sessionId)
+	if len(set.sessions[sessionId]) != 1 {
+		t.Errorf("expired token was expected to be dropped, got %d active tokens", len(set.sessions[sessionId]))
+	}
+}
+
+func TestActiveTokenSetDropsIdleSessions(t *testing.T) {
+	clock := &FixedClock{Time: time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)}
+	set := NewActiveTokenSet(&TokenConfig{Clock: clock}, "LoremIpsum123", time.Minute, 3)
+	set.Issue("user1-login")
+	set.Issue("user2-login")
+
+	clock.Time = clock.Time.Add(2 * time.Minute)
+	set.Issue("user3-login")
+	if _, ok := set.sessions["user1-login"]; ok || len(set.sessions) != 1 {
+		t.Errorf("sessions with expired tokens only were expected to be dropped, got %d sessions", len(set.sessions))
+	}
+
+	token := set.Issue("user3-login")
+	clock.Time = clock.Time.Add(2 * time.Minute)
+	if set.Validate("user3-login", token) {
+		t.Errorf("expired token was expected to be invalid")
+	}
+	if len(set.sessions) != 0 {
+		t.Errorf("session was expected to be dropped on validation once its tokens expired, got %d sessions", len(set.sessions))
+	}
+}
+
+func TestActiveTokenSetKeepsAtLeastOneToken(t *testing.T) {
+	sessionId := "user1-login"
+	set := NewActiveTokenSet(nil, "LoremIpsum123", time.Minute, 0)
+
+	if token := set.Issue(sessionId); !set.Validate(sessionId, token) {
+		t.Errorf("token was expected to be valid with max of zero")
+	}
+}
@@ -0,0 +1,116 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GenerateTokenAud generates a token valid for any of the audiences, e.g. operations of a form performing one of them.
+// See TokenConfig.GenerateTokenAud for details.
+func GenerateTokenAud(sessionId string, audiences []string, expireAt time.Time, secret string) string {
+	return defaultConfig.GenerateTokenAud(sessionId, audiences, expireAt, secret)
+}
+
+// ValidateTokenAud checks if the token generated by GenerateTokenAud is valid and requiredAudience is one of its audiences.
+func ValidateTokenAud(token, sessionId, requiredAudience string, now time.Time, secret string) bool {
+	return defaultConfig.ValidateTokenAud(token, sessionId, requiredAudience, now, secret)
+}
+
+// GenerateTokenAud generates a token valid for any of the audiences, e.g. operations of a form performing one of them.
+// The audiences are prepended to the token as a segment, and covered by the HMAC together with the sessionId.
+// The order of the audiences doesn't matter.
+func (c *TokenConfig) GenerateTokenAud(sessionId string, audiences []string, expireAt time.Time, secret string) string {
+	encoded := encodeAudiences(audiences)
+
+	return base64.RawURLEncoding.EncodeToString(encoded) + TokenTimestampSeparator +
+		c.GenerateToken(audienceSession(encoded, sessionId), expireAt, secret)
+}
+
+// ValidateTokenAud checks if the token generated by GenerateTokenAud is valid and requiredAudience is one of its audiences.
+func (c *TokenConfig) ValidateTokenAud(token, sessionId, requiredAudience string, now time.Time, secret string) bool {
+	segment, rest, ok := strings.Cut(token, TokenTimestampSeparator)
+	if !ok {
+		return false
+	}
+
+	encoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return false
+	}
+	audiences, ok := decodeAudiences(encoded)
+	// only the canonical encoding is accepted, so every audience set has exactly one
+	if !ok || string(encodeAudiences(audiences)) != string(encoded) {
+		return false
+	}
+
+	session := audienceSession(encoded, sessionId)
+	parsed, reason := c.validate(nil, rest, session, now, secret)
+	if reason == "" && !slices.Contains(audiences, requiredAudience) {
+		reason = ReasonWrongAudience
+	}
+	c.report(rest, session, &parsed, reason)
+
+	return reason == ""
+}
+
+// encodeAudiences returns the canonical encoding of the audience set: the number of unique audiences, followed by
+// every audience in sorted order, prefixed with its length.
+func encodeAudiences(audiences []string) []byte {
+	sorted := slices.Compact(slices.Sorted(slices.Values(audiences)))
+
+	encoded := binary.AppendUvarint(nil, uint64(len(sorted)))
+	for _, audience := range sorted {
+		encoded = binary.AppendUvarint(encoded, uint64(len(audience)))
+		encoded = append(encoded, audience...)
+	}
+
+	return encoded
+}
+
+// decodeAudiences reverts encodeAudiences.
+func decodeAudiences(encoded []byte) ([]string, bool) {
+	count, n := binary.Uvarint(encoded)
+	if n <= 0 || count > uint64(len(encoded)) {
+		return nil, false
+	}
+	encoded = encoded[n:]
+
+	audiences := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		size, n := binary.Uvarint(encoded)
+		if n <= 0 || size > uint64(len(encoded[n:])) {
+			return nil, false
+		}
+		audiences = append(audiences, string(encoded[n:n+int(size)]))
+		encoded = encoded[n+int(size):]
+	}
+
+	return audiences, len(encoded) == 0
+}
+
+// audienceSession binds the encoded audiences to the sessionId, so both are covered by the HMAC.
+func audienceSession(encoded []byte, sessionId string) string {
+	return string(binary.AppendUvarint(slices.Clip(encoded), uint64(len(sessionId)))) + sessionId
+}
@@ -0,0 +1,89 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenAudiences(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	token := GenerateTokenAud(sessionId, []string{"post.edit", "post.delete"}, now.Add(time.Minute), secret)
+
+	for _, audience := range []string{"post.edit", "post.delete"} {
+		if !ValidateTokenAud(token, sessionId, audience, now, secret) {
+			t.Errorf("token was expected to be valid for audience in the set: %s", audience)
+		}
+	}
+	if ValidateTokenAud(token, sessionId, "post.publish", now, secret) {
+		t.Errorf("token was expected to be invalid for audience not in the set")
+	}
+	if ValidateTokenAud(token, "user2-login", "post.edit", now, secret) {
+		t.Errorf("token was expected to be invalid for other session")
+	}
+	if ValidateTokenAud(token, sessionId, "post.edit", now.Add(2*time.Minute), secret) {
+		t.Errorf("token was expected to be expired")
+	}
+
+	metrics := &fakeMetrics{}
+	(&TokenConfig{Metrics: metrics}).ValidateTokenAud(token, sessionId, "post.publish", now, secret)
+	if strings.Join(metrics.validated, ",") != ReasonWrongAudience {
+		t.Errorf("token without the audience was expected to be reported once as wrong_audience, got: %v", metrics.validated)
+	}
+}
+
+func TestTokenAudiencesAreOrderIndependent(t *testing.T) {
+	expireAt := time.Now().Add(time.Minute)
+
+	a := GenerateTokenAud("user1-login", []string{"b", "a", "c"}, expireAt, "LoremIpsum123")
+	b := GenerateTokenAud("user1-login", []string{"c", "b", "a", "a"}, expireAt, "LoremIpsum123")
+
+	if a != b {
+		t.Errorf("tokens for the same audience set were expected to be equal: a=%s, b=%s", a, b)
+	}
+}
+
+func TestTokenAudiencesCantBeAltered(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	token := GenerateTokenAud(sessionId, []string{"post.edit"}, now.Add(time.Minute), secret)
+	_, rest, _ := strings.Cut(token, TokenTimestampSeparator)
+
+	altered := base64.RawURLEncoding.EncodeToString(encodeAudiences([]string{"post.edit", "post.delete"})) + TokenTimestampSeparator + rest
+	if ValidateTokenAud(altered, sessionId, "post.delete", now, secret) {
+		t.Errorf("token with altered audiences was expected to be invalid")
+	}
+
+	plain := GenerateToken(sessionId, now.Add(time.Minute), secret)
+	if ValidateTokenAud(plain, sessionId, "post.edit", now, secret) {
+		t.Errorf("token without audiences was expected to be invalid")
+	}
+	if ValidateToken(token, sessionId, now, secret) || ValidateToken(rest, sessionId, now, secret) {
+		t.Errorf("token with audiences was expected to be invalid as plain token")
+	}
+}
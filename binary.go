@@ -0,0 +1,88 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// MarshalBinary packs the token generated by GenerateToken into the raw HMAC followed by the 8-byte big-endian
+// timestamp, half the size of the string, e.g. for binary protocols. See TokenConfig.MarshalBinary for details.
+func MarshalBinary(token string) ([]byte, error) {
+	return defaultConfig.MarshalBinary(token)
+}
+
+// UnmarshalBinary reverts MarshalBinary and returns the token string.
+func UnmarshalBinary(data []byte) (string, error) {
+	return defaultConfig.UnmarshalBinary(data)
+}
+
+// MarshalBinary packs the token into the raw HMAC followed by every timestamp as 8-byte big-endian unix time.
+// The version is not packed, so only tokens with the version the config generates can be packed.
+// It fails with ErrMalformedToken when the token can't be restored exactly by UnmarshalBinary.
+func (c *TokenConfig) MarshalBinary(token string) ([]byte, error) {
+	parsed, err := c.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Version != c.version() {
+		return nil, ErrUnsupportedVersion
+	}
+
+	hash, err := hex.DecodeString(parsed.Hash)
+	if err != nil || len(hash) != c.hash().Size() || hex.EncodeToString(hash) != parsed.Hash {
+		return nil, ErrMalformedToken
+	}
+
+	data := append(make([]byte, 0, c.binaryLength()), hash...)
+	for _, raw := range []string{parsed.RawTimestamp, parsed.rawIssuedAt}[:c.timestampCount()] {
+		ts, err := c.decodeTimestamp(raw)
+		if err != nil {
+			return nil, ErrBadTimestamp
+		}
+		data = binary.BigEndian.AppendUint64(data, uint64(ts))
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary reverts MarshalBinary and returns the token string.
+// It fails with ErrMalformedToken when the data doesn't have the length of packed tokens.
+func (c *TokenConfig) UnmarshalBinary(data []byte) (string, error) {
+	if len(data) != c.binaryLength() {
+		return "", ErrMalformedToken
+	}
+
+	size := c.hash().Size()
+
+	var timestamps []string
+	for rest := data[size:]; len(rest) > 0; rest = rest[8:] {
+		timestamps = append(timestamps, c.formatTimestamp(time.Unix(int64(binary.BigEndian.Uint64(rest)), 0)))
+	}
+
+	return string(c.appendToken(nil, hex.AppendEncode(nil, data[:size]), timestamps)), nil
+}
+
+// binaryLength returns the length of tokens packed by MarshalBinary.
+func (c *TokenConfig) binaryLength() int {
+	return c.hash().Size() + 8*c.timestampCount()
+}
@@ -0,0 +1,86 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto"
+	"testing"
+	"time"
+)
+
+func TestBinaryTokenRoundTrip(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(time.Minute), secret)
+
+	data, err := MarshalBinary(token)
+	if err != nil {
+		t.Fatalf("token was expected to be marshaled: %s", err)
+	}
+	if len(data) != 36 || len(data) >= len(token) {
+		t.Errorf("packed token was expected to have 36 bytes, got: %d", len(data))
+	}
+
+	unpacked, err := UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("token was expected to be unmarshaled: %s", err)
+	}
+	if unpacked != token {
+		t.Errorf("unmarshaled token was expected to equal the original: original=%s, unmarshaled=%s", token, unpacked)
+	}
+	if !ValidateToken(unpacked, sessionId, now, secret) || ValidateToken(unpacked, sessionId, now.Add(2*time.Minute), secret) {
+		t.Errorf("unmarshaled token was expected to validate like the original")
+	}
+}
+
+func TestBinaryTokenRoundTripWithConfig(t *testing.T) {
+	now := time.Now()
+	configs := []*TokenConfig{
+		{IncludeIssuedAt: true, Versioned: true},
+		{OpaqueTimestamp: true, Hash: crypto.SHA256},
+		{FixedWidth: true, RelativeExpiry: true, IncludeIssuedAt: true},
+	}
+
+	for _, config := range configs {
+		token := config.GenerateToken("user1-login", now.Add(time.Minute), "LoremIpsum123")
+
+		data, err := config.MarshalBinary(token)
+		if err != nil {
+			t.Fatalf("token was expected to be marshaled for %+v: %s", config, err)
+		}
+		if unpacked, err := config.UnmarshalBinary(data); err != nil || unpacked != token {
+			t.Errorf("unmarshaled token was expected to equal the original: original=%s, unmarshaled=%s, err=%v", token, unpacked, err)
+		}
+	}
+}
+
+func TestMarshalBinaryRejectsMalformedTokens(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+
+	for _, malformed := range []string{"", "lorem", "ABC" + token[3:], token[1:], "zz" + token[2:]} {
+		if _, err := MarshalBinary(malformed); err == nil {
+			t.Errorf("malformed token was expected to be rejected: %q", malformed)
+		}
+	}
+	if _, err := UnmarshalBinary(make([]byte, 35)); err != ErrMalformedToken {
+		t.Errorf("data of wrong length was expected to be rejected with ErrMalformedToken, got: %v", err)
+	}
+}
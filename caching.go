@@ -0,0 +1,114 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CachingValidator validates tokens like TokenConfig.ValidateToken, but remembers the computed HMAC of recently seen
+// tokens, so validating the same token again (e.g. on every websocket message) skips the HMAC computation.
+// Cached entries never outlive the token expiration and the least recently used ones are evicted above the size.
+// The presented hash is still compared in constant time on every validation.
+// CachingValidator is safe for concurrent use.
+type CachingValidator struct {
+	config *TokenConfig
+	secret string
+	size   int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	contents string
+	sample   []byte
+	expireAt time.Time
+}
+
+// NewCachingValidator creates a CachingValidator for tokens generated with the config (nil for the default one)
+// and the secret, caching up to size entries.
+func NewCachingValidator(config *TokenConfig, secret string, size int) *CachingValidator {
+	if config == nil {
+		config = defaultConfig
+	}
+
+	return &CachingValidator{
+		config:  config,
+		secret:  secret,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// ValidateToken checks if the token is valid for the session and has not expired.
+func (v *CachingValidator) ValidateToken(token, sessionId string, now time.Time) bool {
+	m := v.config.getMac()
+	defer v.config.putMac(m)
+	m.sample = func(m *macState, expireAt time.Time) []byte {
+		return v.sample(m, expireAt, now)
+	}
+
+	parsed, reason := v.config.validate(m, token, sessionId, now, v.secret)
+	v.config.report(token, sessionId, &parsed, reason)
+
+	return reason == ""
+}
+
+// sample returns the hex encoded HMAC of the contents in m.buf from the cache, computing it with m on a miss.
+func (v *CachingValidator) sample(m *macState, expireAt, now time.Time) []byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if element, ok := v.entries[string(m.buf)]; ok {
+		v.lru.MoveToFront(element)
+		return element.Value.(*cacheEntry).sample
+	}
+
+	m.setKey(v.config.key(v.secret))
+	sample := bytes.Clone(m.keyedHexSum())
+	// the samples of expired tokens would never be used again
+	if expireAt.Before(now) {
+		return sample
+	}
+	contents := string(m.buf)
+	v.entries[contents] = v.lru.PushFront(&cacheEntry{contents: contents, sample: sample, expireAt: expireAt})
+
+	// evict above the size and expired entries, until the least recently used one is still valid
+	for v.lru.Len() > 0 {
+		back := v.lru.Back()
+		if v.lru.Len() <= v.size && !back.Value.(*cacheEntry).expireAt.Before(now) {
+			break
+		}
+		v.remove(back)
+	}
+
+	return sample
+}
+
+func (v *CachingValidator) remove(element *list.Element) {
+	v.lru.Remove(element)
+	delete(v.entries, element.Value.(*cacheEntry).contents)
+}
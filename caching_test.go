@@ -0,0 +1,185 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachingValidatorCacheHit(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+	validator := NewCachingValidator(nil, secret, 10)
+
+	first := validator.ValidateToken(token, sessionId, now)
+	second := validator.ValidateToken(token, sessionId, now)
+
+	if !first || !second {
+		t.Errorf("token validation failed: first=%t, second=%t", first, second)
+	}
+	if validator.lru.Len() != 1 {
+		t.Errorf("one cache entry was expected, got: %d", validator.lru.Len())
+	}
+
+	if validator.ValidateToken(token, "user2-login", now) {
+		t.Errorf("token validation was expected to fail for other sessionId, but passed")
+	}
+	if validator.ValidateToken(token+"0", sessionId, now) {
+		t.Errorf("token validation was expected to fail for tampered token, but passed")
+	}
+}
+
+func TestCachingValidatorEvictsLeastRecentlyUsed(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+	validator := NewCachingValidator(nil, secret, 2)
+
+	for _, sessionId := range []string{"user1-login", "user2-login", "user3-login"} {
+		if !validator.ValidateToken(GenerateToken(sessionId, expireAt, secret), sessionId, now) {
+			t.Errorf("token validation failed: sessionId=%s", sessionId)
+		}
+	}
+
+	if validator.lru.Len() != 2 {
+		t.Errorf("two cache entries were expected, got: %d", validator.lru.Len())
+	}
+	if _, ok := validator.entries[tokenContents("user1-login", strconv.FormatInt(expireAt.Unix(), 10))]; ok {
+		t.Errorf("the least recently used entry was expected to be evicted")
+	}
+}
+
+func TestCachingValidatorDropsExpiredEntries(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	validator := NewCachingValidator(nil, secret, 10)
+
+	token := GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+	validator.ValidateToken(token, sessionId, now)
+
+	later := now.Add(10 * time.Minute)
+	if validator.ValidateToken(token, sessionId, later) {
+		t.Errorf("expired token validation was expected to fail, but passed")
+	}
+
+	validator.ValidateToken(GenerateToken(sessionId, later.Add(5*time.Minute), secret), sessionId, later)
+
+	if validator.lru.Len() != 1 {
+		t.Errorf("expired entry was expected to be dropped, got %d entries", validator.lru.Len())
+	}
+}
+
+func TestCachingValidatorMACModes(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	for _, mode := range []MACMode{HMAC, BLAKE2Keyed} {
+		config := &TokenConfig{MACMode: mode}
+		token := config.GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+		validator := NewCachingValidator(config, secret, 10)
+
+		for i := 0; i < 2; i++ {
+			if !validator.ValidateToken(token, sessionId, now) {
+				t.Errorf("token of MACMode %d was expected to be valid: attempt=%d", mode, i)
+			}
+		}
+		if validator.ValidateToken(token, "user2-login", now) {
+			t.Errorf("token of MACMode %d was expected to be invalid for another session", mode)
+		}
+	}
+}
+
+func TestCachingValidatorCaseInsensitiveHex(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	config := &TokenConfig{CaseInsensitiveHex: true}
+	token := strings.ToUpper(config.GenerateToken(sessionId, now.Add(5*time.Minute), secret))
+
+	if !NewCachingValidator(config, secret, 10).ValidateToken(token, sessionId, now) {
+		t.Errorf("uppercased token was expected to be valid with CaseInsensitiveHex: token=%s", token)
+	}
+	if NewCachingValidator(nil, secret, 10).ValidateToken(token, sessionId, now) {
+		t.Errorf("uppercased token was expected to be invalid by default: token=%s", token)
+	}
+}
+
+func TestCachingValidatorChecksHMACBeforeTimes(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	metrics := &fakeMetrics{}
+	var logged []string
+	config := &TokenConfig{Metrics: metrics, Logger: func(msg string, fields map[string]any) {
+		logged = append(logged, fields["reason"].(string))
+	}}
+	validator := NewCachingValidator(config, secret, 10)
+
+	expired := config.GenerateToken(sessionId, now.Add(-time.Minute), secret)
+	forged := config.GenerateToken(sessionId, now.Add(-time.Minute), "LoremIpsum124")
+	validator.ValidateToken(expired, sessionId, now)
+	validator.ValidateToken(forged, sessionId, now)
+
+	if strings.Join(metrics.validated, ",") != "expired,mismatch" {
+		t.Errorf("forged expired token was expected to be reported as a mismatch, got: %v", metrics.validated)
+	}
+	if strings.Join(logged, ",") != "expired,mismatch" {
+		t.Errorf("rejections were expected to be logged, got: %v", logged)
+	}
+	if validator.lru.Len() != 0 {
+		t.Errorf("expired tokens were not expected to be cached, got %d entries", validator.lru.Len())
+	}
+
+	strict := NewCachingValidator(&TokenConfig{StrictSecret: true, Metrics: metrics}, "", 10)
+	if strict.ValidateToken(GenerateToken(sessionId, now.Add(time.Minute), ""), sessionId, now) {
+		t.Errorf("token was expected to be rejected for an empty secret with StrictSecret")
+	}
+}
+
+func TestCachingValidatorConstantTimeReject(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	var computed int
+	testHookHMAC = func() { computed++ }
+	defer func() { testHookHMAC = nil }()
+
+	validator := NewCachingValidator(&TokenConfig{ConstantTimeReject: true}, secret, 10)
+	for _, token := range []string{"", "lorem", strings.Repeat("a", 200)} {
+		computed = 0
+		if validator.ValidateToken(token, sessionId, now) {
+			t.Errorf("malformed token was expected to be invalid: %s", token)
+		}
+		if computed != 1 {
+			t.Errorf("HMAC of malformed token was expected to be computed once, computed: %d, token: %s", computed, token)
+		}
+	}
+	if validator.lru.Len() != 0 {
+		t.Errorf("malformed tokens were not expected to be cached, got %d entries", validator.lru.Len())
+	}
+}
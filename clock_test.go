@@ -0,0 +1,68 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenFlowUnderFixedClock(t *testing.T) {
+	clock := &FixedClock{Time: time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)}
+	config := &TokenConfig{Clock: clock, IncludeIssuedAt: true, MaxAge: 10 * time.Minute}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+
+	token := config.GenerateTokenTTL(sessionId, 5*time.Minute, secret)
+
+	parsed, _ := config.ParseToken(token)
+	if !parsed.ExpiresAt.Equal(clock.Time.Add(5*time.Minute)) || !parsed.IssuedAt.Equal(clock.Time) {
+		t.Errorf("token times were expected to come from the clock: expiresAt=%s, issuedAt=%s", parsed.ExpiresAt, parsed.IssuedAt)
+	}
+
+	clock.Time = clock.Time.Add(4 * time.Minute)
+	if !config.ValidateTokenNow(token, sessionId, secret) {
+		t.Errorf("token validation failed: token=%s, now=%s", token, clock.Time)
+	}
+
+	clock.Time = clock.Time.Add(2 * time.Minute)
+	if config.ValidateTokenNow(token, sessionId, secret) {
+		t.Errorf("token validation was expected to fail after expiry, but passed: token=%s, now=%s", token, clock.Time)
+	}
+}
+
+func TestMiddlewareUsesConfigClock(t *testing.T) {
+	clock := &FixedClock{Time: time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)}
+	config := testMiddlewareConfig()
+	config.Config = &TokenConfig{Clock: clock}
+	config.TTL = 5 * time.Minute
+
+	_, token := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	clock.Time = clock.Time.Add(6 * time.Minute)
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", token)
+
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+		t.Errorf("expired token was expected to be rejected, got status: %d", w.Code)
+	}
+}
@@ -0,0 +1,96 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Command csrftool generates and verifies HMAC Based CSRF Tokens from the command line.
+//
+// Usage:
+//
+//	csrftool gen -session <sessionId> -secret <secret> [-ttl <duration>]
+//	csrftool verify -token <token> -session <sessionId> -secret <secret>
+package main
+
+import (
+	"csrf"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+func run(args []string, out io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprintln(out, "usage: csrftool gen|verify [flags]")
+		return 2
+	}
+
+	switch args[0] {
+	case "gen":
+		return gen(args[1:], out)
+	case "verify":
+		return verify(args[1:], out)
+	default:
+		fmt.Fprintf(out, "unknown command: %s\n", args[0])
+		return 2
+	}
+}
+
+func gen(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	fs.SetOutput(out)
+	sessionId := fs.String("session", "", "session ID the token is generated for")
+	secret := fs.String("secret", "", "secret used to sign the token")
+	ttl := fs.Duration("ttl", time.Hour, "time after which the token expires")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	fmt.Fprintln(out, csrf.GenerateToken(*sessionId, time.Now().Add(*ttl), *secret))
+
+	return 0
+}
+
+func verify(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(out)
+	token := fs.String("token", "", "token to verify")
+	sessionId := fs.String("session", "", "session ID the token was generated for")
+	secret := fs.String("secret", "", "secret used to sign the token")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	expiry := "unknown"
+	if parsed, err := csrf.ParseToken(*token); err == nil {
+		expiry = parsed.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	if !csrf.ValidateToken(*token, *sessionId, time.Now(), *secret) {
+		fmt.Fprintf(out, "invalid (expires at %s)\n", expiry)
+		return 1
+	}
+
+	fmt.Fprintf(out, "valid (expires at %s)\n", expiry)
+
+	return 0
+}
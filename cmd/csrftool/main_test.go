@@ -0,0 +1,68 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenThenVerify(t *testing.T) {
+	var out bytes.Buffer
+
+	if code := run([]string{"gen", "-session", "user1-login", "-secret", "LoremIpsum123"}, &out); code != 0 {
+		t.Fatalf("gen exited with %d: %s", code, out.String())
+	}
+	token := strings.TrimSpace(out.String())
+
+	out.Reset()
+	if code := run([]string{"verify", "-token", token, "-session", "user1-login", "-secret", "LoremIpsum123"}, &out); code != 0 {
+		t.Errorf("verify exited with %d: %s", code, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "valid (expires at ") {
+		t.Errorf("unexpected verify output: %s", out.String())
+	}
+}
+
+func TestVerifyInvalidToken(t *testing.T) {
+	var out bytes.Buffer
+
+	if code := run([]string{"gen", "-session", "user1-login", "-secret", "LoremIpsum123"}, &out); code != 0 {
+		t.Fatalf("gen exited with %d: %s", code, out.String())
+	}
+	token := strings.TrimSpace(out.String())
+
+	out.Reset()
+	if code := run([]string{"verify", "-token", token, "-session", "user1-login", "-secret", "LoremIpsum1234"}, &out); code != 1 {
+		t.Errorf("verify was expected to exit with 1, exited with %d: %s", code, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "invalid (expires at ") {
+		t.Errorf("unexpected verify output: %s", out.String())
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+
+	if code := run([]string{"lorem"}, &out); code != 2 {
+		t.Errorf("unknown command was expected to exit with 2, exited with %d", code)
+	}
+}
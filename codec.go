@@ -0,0 +1,70 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import "time"
+
+// Codec generates and validates tokens. HMACCodec is the implementation of this package, another one, e.g. producing
+// encrypted tokens, can replace it in Middleware.
+type Codec interface {
+	// Generate generates a token for the session, expiring at expireAt.
+	Generate(sessionId string, expireAt time.Time) string
+	// Validate checks if the token is valid for the session at the time.
+	Validate(token, sessionId string, now time.Time) bool
+}
+
+// HMACCodec is the Codec of HMAC Based CSRF Tokens, generated and validated with the config and the secret.
+type HMACCodec struct {
+	// Config is used to generate and validate the tokens, the zero TokenConfig by default.
+	Config *TokenConfig
+	// Secret is used to generate and validate the tokens.
+	Secret string
+}
+
+// Generate generates a token like TokenConfig.GenerateToken.
+func (c *HMACCodec) Generate(sessionId string, expireAt time.Time) string {
+	return c.config().GenerateToken(sessionId, expireAt, c.Secret)
+}
+
+// Validate validates the token like TokenConfig.ValidateToken.
+func (c *HMACCodec) Validate(token, sessionId string, now time.Time) bool {
+	return c.config().ValidateToken(token, sessionId, now, c.Secret)
+}
+
+func (c *HMACCodec) config() *TokenConfig {
+	if c.Config == nil {
+		return defaultConfig
+	}
+
+	return c.Config
+}
+
+// managerCodec is the Codec of a Manager.
+type managerCodec struct {
+	m *Manager
+}
+
+func (c managerCodec) Generate(sessionId string, expireAt time.Time) string {
+	return c.m.generate(sessionId, expireAt)
+}
+
+func (c managerCodec) Validate(token, sessionId string, now time.Time) bool {
+	return c.m.validate(token, sessionId, now)
+}
@@ -0,0 +1,99 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// plainCodec issues the sessionId itself as the token.
+type plainCodec struct{}
+
+func (plainCodec) Generate(sessionId string, expireAt time.Time) string {
+	return "plain:" + sessionId
+}
+
+func (plainCodec) Validate(token, sessionId string, now time.Time) bool {
+	return token == "plain:"+sessionId
+}
+
+func TestMiddlewareUsesCodec(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.Codec = plainCodec{}
+
+	_, token := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/", nil))
+	if token != "plain:user1-login" {
+		t.Errorf("token was expected to be issued by the codec, got: %s", token)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", "plain:user1-login")
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusOK {
+		t.Errorf("token accepted by the codec was expected to pass, got status: %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+		t.Errorf("HMAC token was expected to be rejected by the codec, got status: %d", w.Code)
+	}
+}
+
+func TestHMACCodec(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	codec := &HMACCodec{Secret: secret}
+
+	token := codec.Generate(sessionId, now.Add(time.Minute))
+	if token != GenerateToken(sessionId, now.Add(time.Minute), secret) {
+		t.Errorf("codec was expected to generate the same token as GenerateToken, got: %s", token)
+	}
+	if !codec.Validate(token, sessionId, now) {
+		t.Errorf("token was expected to be valid")
+	}
+	if codec.Validate(token, "user2-login", now) {
+		t.Errorf("token was expected to be invalid for another session")
+	}
+}
+
+func TestManagerCodecAcceptsAllSecrets(t *testing.T) {
+	sessionId := "user1-login"
+	now := time.Now()
+	m, err := NewManager(nil, "LoremIpsum123", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := m.Codec().Generate(sessionId, now.Add(time.Minute))
+	if err := m.SetSecrets([]string{"DolorSitAmet456", "LoremIpsum123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	codec := m.Codec()
+	if !codec.Validate(old, sessionId, now) {
+		t.Errorf("token generated with the previous secret was expected to be valid")
+	}
+	if fresh := codec.Generate(sessionId, now.Add(time.Minute)); !ValidateToken(fresh, sessionId, now, "DolorSitAmet456") {
+		t.Errorf("token was expected to be generated with the primary secret")
+	}
+}
@@ -0,0 +1,974 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"context"
+	"crypto"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// TokenConfig changes how tokens are generated and validated.
+// The zero value produces the same tokens as GenerateToken and ValidateToken.
+// Tokens must be validated with the same config they were generated with.
+type TokenConfig struct {
+	// IncludeIssuedAt embeds the time of generation as the third token segment, covered by the HMAC.
+	// Validation rejects tokens issued in the future.
+	IncludeIssuedAt bool
+	// MaxAge is the maximum age of a token, counted from its issuance time, regardless of its expiration date.
+	// It is used only together with IncludeIssuedAt, zero means no limit.
+	MaxAge time.Duration
+	// Tolerance widens the validity window on both sides, so a token is valid from its issuance time minus Tolerance
+	// until its expiration date plus Tolerance, e.g. to absorb clock differences between servers. No tolerance by default.
+	Tolerance time.Duration
+	// Hash is the hash function used by HMAC, SHA-512/224 by default.
+	// Any available hash can be used, e.g. crypto.SHA256, crypto.SHA3_256 (with crypto/sha3 imported)
+	// or crypto.BLAKE2b_512 (with golang.org/x/crypto/blake2b imported). Using a hash that is not available panics.
+	Hash crypto.Hash
+	// MACMode selects the MAC, HMAC by default. BLAKE2Keyed tokens are never accepted by an HMAC config,
+	// and vice versa.
+	MACMode MACMode
+	// Clock is used for every time read performed by the config, the system clock by default.
+	Clock Clock
+	// Metrics is notified about generated and validated tokens, no-op by default.
+	Metrics Metrics
+	// Logger is called for every rejected token with the reason, the TokenFingerprint and the expiration date of the token
+	// (if it could be parsed), e.g. to diagnose rejections in staging. Neither the secret nor the hash is passed.
+	// No logging by default.
+	Logger func(msg string, fields map[string]any)
+	// Slog, when set, records every validation at SlogLevel with the attributes valid, reason,
+	// session_id_fingerprint (the TokenFingerprint of the sessionId) and expires_at (if the token could be parsed).
+	// Neither the secret, the token nor the sessionId is recorded. No records by default.
+	Slog *slog.Logger
+	// SlogLevel is the level of the records sent to Slog, slog.LevelInfo by default.
+	SlogLevel slog.Level
+	// MaxTokenLength is the maximum length of a token, longer ones are rejected as malformed before any parsing or
+	// HMAC computation, so oversized input can't be used to waste resources. Twice the TokenLength by default, which
+	// leaves room to report what is wrong with slightly malformed tokens. Negative disables the limit.
+	MaxTokenLength int
+	// ConstantTimeReject computes the HMAC of malformed tokens too, discarding it, so rejecting them takes as long as
+	// rejecting a well-formed forged token, for threat models where the timing must not reveal the failure reason.
+	// Disabled by default.
+	ConstantTimeReject bool
+	// TrimInput removes leading and trailing ASCII whitespace from the token before parsing it, e.g. a newline appended
+	// by a proxy or a textarea. Disabled by default.
+	TrimInput bool
+	// OpaqueTimestamp encodes the timestamps in the token so they don't reveal the expiration date at first glance.
+	// It is obfuscation, not encryption - anyone who knows the encoding can read them. Timestamps are still covered by
+	// the HMAC, so they can't be altered.
+	OpaqueTimestamp bool
+	// DebugTimestamps encodes the timestamps in the token as RFC 3339 in UTC, e.g. "2021-01-04T12:00:00Z", instead of
+	// unix time, so they are readable in logs. It is meant for diagnostics, not production. Timestamps are still covered
+	// by the HMAC, and such tokens are never accepted by a config without DebugTimestamps, and vice versa.
+	// It takes precedence over OpaqueTimestamp.
+	DebugTimestamps bool
+	// CaseInsensitiveHex accepts the hash of the token in uppercase, or mixed case, e.g. when a proxy changes its case.
+	// The hash is lowercased before the comparison. Only lowercase hashes are accepted by default.
+	CaseInsensitiveHex bool
+	// Versioned prefixes generated tokens with the format version, e.g. "v2.<hash>.<timestamp>".
+	// Since v2, a domain separation tag is covered by the HMAC, so it never matches an HMAC computed by another
+	// subsystem over the same data with the same secret. Validation rejects tokens with an unknown version.
+	Versioned bool
+	// LegacyUntil is the moment until which a Versioned config still accepts tokens without the version or with
+	// an older version, so tokens issued before the upgrade remain valid during the deployment.
+	// Zero rejects them right away.
+	LegacyUntil time.Time
+	// FixedWidth drops the separators from the token: the hash is followed directly by the timestamps zero-padded to a
+	// fixed width, and the token is split at known offsets, e.g. for proxies mangling "." in headers.
+	// Such tokens are never accepted by a config without FixedWidth, and vice versa.
+	FixedWidth bool
+	// PadTimestamps zero-pads the timestamps to a fixed width, so all tokens of the config have the same length,
+	// whatever their expiration dates. The timestamps are covered by the HMAC as padded, and validation accepts only
+	// padded ones. Such tokens are never accepted by a config without PadTimestamps, and vice versa.
+	PadTimestamps bool
+	// TimestampFirst puts the timestamps before the hash, e.g. "<timestamp>.<hash>", to interoperate with services
+	// using that order. The HMAC input is the same in both orders. Such tokens are never accepted by a config without
+	// TimestampFirst, and vice versa.
+	TimestampFirst bool
+	// FramedContents prefixes every field of the HMAC input with its length, instead of joining them with "|".
+	// The default input is already unambiguous, as timestamps never contain "|", but framing keeps it so regardless
+	// of the fields' contents. Such tokens are never accepted by a config without FramedContents, and vice versa.
+	FramedContents bool
+	// MinSecretLength is the minimum length of the secret in bytes, enforced by GenerateTokenSafe and NewManager.
+	// Zero disables the check, DefaultMinSecretLength is recommended.
+	MinSecretLength int
+	// StrictSecret fails closed on a missing secret: validation with an empty secret always fails
+	// (ReasonEmptySecret), and GenerateTokenSafe and NewManager fail with ErrEmptySecret.
+	// Empty secrets are accepted by default, for compatibility.
+	StrictSecret bool
+	// RelativeExpiry embeds the expiration date as seconds from the issuance time instead of unix time, as sent by some
+	// legacy clients. It is used only together with IncludeIssuedAt.
+	RelativeExpiry bool
+	// Prefix is an application label covered by the HMAC, so tokens of apps sharing the secret and sessionIds are never
+	// valid in each other. Generation and validation must use the same prefix. No prefix by default.
+	Prefix string
+	// Horizon is the latest time a token timestamp may represent, later ones are rejected as malformed, so an absurd
+	// far-future expiration date can't make a token valid forever. The beginning of year 2100 by default.
+	Horizon time.Time
+	// StretchSecret derives the HMAC key from the secret with PBKDF2-HMAC-SHA256, which makes guessing a low-entropy
+	// secret from tokens expensive. The key is derived once per secret and cached. Disabled by default.
+	StretchSecret bool
+	// StretchIterations is the PBKDF2 iteration count used with StretchSecret, 600000 by default.
+	StretchIterations int
+	// StretchSalt is the PBKDF2 salt used with StretchSecret, e.g. the application name, a fixed one by default.
+	StretchSalt string
+
+	// ExpiryJitter randomly shortens the lifetime of every generated token by up to the duration (in whole seconds),
+	// so tokens issued at once don't all expire at the same moment. No jitter by default.
+	ExpiryJitter time.Duration
+
+	// stretched caches the keys derived with StretchSecret by secret, both immutable strings that can't be wiped
+	stretched sync.Map
+	// jitter returns a random number in [0, n), rand.Int64N by default
+	jitter func(n int64) int64
+}
+
+const (
+	defaultStretchIterations = 600000
+	defaultStretchSalt       = "csrf: HMAC key derivation"
+)
+
+// defaultHorizon is the default TokenConfig.Horizon.
+var defaultHorizon = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	// tokenVersion is the format version of the generated tokens, see TokenConfig.Versioned.
+	tokenVersion = "v2"
+	// legacyTokenVersion is the previous format version, without the domainTag.
+	legacyTokenVersion = "v1"
+	// domainTag is covered by the HMAC of tokenVersion tokens.
+	domainTag = "csrf-v2"
+)
+
+// GenerateToken generates HMAC Based CSRF Token using the config.
+// See GenerateToken function for the description of the arguments.
+func (c *TokenConfig) GenerateToken(sessionId string, expireAt time.Time, secret string) string {
+	var tsb strings.Builder
+	c.WriteToken(&tsb, sessionId, expireAt, secret)
+
+	return tsb.String()
+}
+
+// WriteToken writes the token GenerateToken generates for the same arguments to w, e.g. straight into a response,
+// without allocating the token string. It returns the number of bytes written and any write error.
+func (c *TokenConfig) WriteToken(w io.Writer, sessionId string, expireAt time.Time, secret string) (int, error) {
+	return c.writeToken(w, sessionId, c.timestamps(expireAt), secret)
+}
+
+// writeToken writes the token with the timestamp segments to w.
+func (c *TokenConfig) writeToken(w io.Writer, sessionId string, timestamps []string, secret string) (int, error) {
+	m := c.getMac()
+	defer c.putMac(m)
+
+	m.buf = c.appendContents(m.buf[:0], c.version(), sessionId, timestamps...)
+	m.setKey(c.key(secret))
+	hash := m.keyedHexSum()
+	c.metrics().IncGenerated()
+
+	m.scratch = c.appendToken(m.scratch[:0], hash, timestamps)
+
+	return w.Write(m.scratch)
+}
+
+// appendToken appends the token with the hex encoded hash and the timestamp segments to dst.
+func (c *TokenConfig) appendToken(dst, hash []byte, timestamps []string) []byte {
+	if c.Versioned {
+		dst = append(dst, tokenVersion...)
+		dst = append(dst, c.separator()...)
+	}
+	if !c.TimestampFirst {
+		dst = append(dst, hash...)
+	}
+	for i, ts := range timestamps {
+		if i > 0 || !c.TimestampFirst {
+			dst = append(dst, c.separator()...)
+		}
+		dst = append(dst, ts...)
+	}
+	if c.TimestampFirst {
+		dst = append(dst, c.separator()...)
+		dst = append(dst, hash...)
+	}
+
+	return dst
+}
+
+// Resign re-issues the token, valid for the session at the time under oldSecret, signed with newSecret, e.g. to move
+// clients to a new secret during rotation. The timestamps of the token, and so its expiration date, are kept as they are.
+// It returns false and an empty string when the token is not valid under oldSecret.
+func (c *TokenConfig) Resign(token, sessionId string, now time.Time, oldSecret, newSecret string) (string, bool) {
+	parsed, valid := c.validateToken(token, sessionId, now, oldSecret)
+	if !valid {
+		return "", false
+	}
+
+	timestamps := []string{parsed.RawTimestamp}
+	if parsed.rawIssuedAt != "" {
+		timestamps = append(timestamps, parsed.rawIssuedAt)
+	}
+
+	var tsb strings.Builder
+	c.writeToken(&tsb, sessionId, timestamps, newSecret)
+
+	return tsb.String(), true
+}
+
+// TokenMAC returns the raw HMAC of the token GenerateToken generates for the same arguments, e.g. to embed it in
+// another signed envelope. With IncludeIssuedAt, it covers the issuance time read from the Clock.
+func (c *TokenConfig) TokenMAC(sessionId string, expireAt time.Time, secret string) []byte {
+	return c.tokenMAC(sessionId, c.timestamps(expireAt), secret)
+}
+
+// timestamps returns the timestamp segments of a new token expiring at expireAt.
+func (c *TokenConfig) timestamps(expireAt time.Time) []string {
+	if seconds := int64(c.ExpiryJitter / time.Second); seconds > 0 {
+		jitter := rand.Int64N
+		if c.jitter != nil {
+			jitter = c.jitter
+		}
+		expireAt = expireAt.Add(-time.Duration(jitter(seconds+1)) * time.Second)
+	}
+
+	timestamps := []string{c.formatTimestamp(expireAt)}
+	if c.IncludeIssuedAt {
+		issuedAt := c.now()
+		if c.RelativeExpiry {
+			timestamps[0] = c.formatTimestamp(time.Unix(expireAt.Unix()-issuedAt.Unix(), 0))
+		}
+		timestamps = append(timestamps, c.formatTimestamp(issuedAt))
+	}
+
+	return timestamps
+}
+
+// tokenMAC returns a copy of the raw HMAC of the token with the timestamps.
+func (c *TokenConfig) tokenMAC(sessionId string, timestamps []string, secret string) []byte {
+	m := c.getMac()
+	defer c.putMac(m)
+
+	m.buf = c.appendContents(m.buf[:0], c.version(), sessionId, timestamps...)
+	m.setKey(c.key(secret))
+
+	return append([]byte(nil), m.keyedSum()...)
+}
+
+// appendContents appends the HMAC input of the token with the version and the timestamps to dst.
+func (c *TokenConfig) appendContents(dst []byte, version, sessionId string, timestamps ...string) []byte {
+	if version == tokenVersion {
+		dst = binary.AppendUvarint(dst, uint64(len(domainTag)))
+		dst = append(dst, domainTag...)
+	}
+	dst = c.appendPrefix(dst)
+	if c.FramedContents {
+		return appendFramedContents(dst, sessionId, timestamps...)
+	}
+
+	return appendTokenContents(dst, sessionId, timestamps...)
+}
+
+// appendParsedContents appends the HMAC input of the parsed token to dst.
+func (c *TokenConfig) appendParsedContents(dst []byte, sessionId string, parsed *ParsedToken) []byte {
+	if parsed.rawIssuedAt == "" {
+		return c.appendContents(dst, parsed.Version, sessionId, parsed.RawTimestamp)
+	}
+
+	return c.appendContents(dst, parsed.Version, sessionId, parsed.RawTimestamp, parsed.rawIssuedAt)
+}
+
+// GenerateTokenSafe works like GenerateToken, but fails with ErrWeakSecret when the secret is shorter than MinSecretLength,
+// and with ErrZeroExpiry for the zero expireAt, which would produce a token that has always expired.
+func (c *TokenConfig) GenerateTokenSafe(sessionId string, expireAt time.Time, secret string) (string, error) {
+	if err := c.checkSecret(secret); err != nil {
+		return "", err
+	}
+	if expireAt.IsZero() {
+		return "", ErrZeroExpiry
+	}
+
+	return c.GenerateToken(sessionId, expireAt, secret), nil
+}
+
+// GenerateTokenTTL generates a token that expires after ttl, counted from the time returned by the Clock.
+func (c *TokenConfig) GenerateTokenTTL(sessionId string, ttl time.Duration, secret string) string {
+	return c.GenerateToken(sessionId, c.now().Add(ttl), secret)
+}
+
+// ValidateTokenNow works like ValidateToken at the time returned by the Clock.
+func (c *TokenConfig) ValidateTokenNow(token, sessionId string, secret string) bool {
+	return c.ValidateToken(token, sessionId, c.now(), secret)
+}
+
+// ValidateToken checks if the HMAC Based CSRF Token is valid for the session and has not expired.
+// When IncludeIssuedAt is set, the token must also carry an issuance time that is not in the future and not older than MaxAge.
+// Token is compared using subtle.ConstantTimeCompare to mitigate timing attacks.
+func (c *TokenConfig) ValidateToken(token, sessionId string, now time.Time, secret string) bool {
+	_, valid := c.validateToken(token, sessionId, now, secret)
+
+	return valid
+}
+
+// Diagnose returns every reason why the token is invalid for the session at the time, e.g. both ReasonMismatch and
+// ReasonExpired for an expired forged token, or nil for a valid token. Unlike validation, it checks everything, and
+// the reasons reveal what is wrong with the token, so it is meant only for debugging, never for responses to clients.
+// Metrics, Logger and Slog are not notified.
+func (c *TokenConfig) Diagnose(token, sessionId string, now time.Time, secret string) []string {
+	var reasons []string
+	if c.StrictSecret && secret == "" {
+		reasons = append(reasons, ReasonEmptySecret)
+	}
+
+	parsed, err := c.parseToken(token)
+	if err == ErrUnsupportedVersion {
+		return append(reasons, ReasonUnsupportedVersion)
+	}
+	if err != nil {
+		return append(reasons, ReasonMalformed)
+	}
+
+	if reason := c.checkSignature(nil, &parsed, sessionId, secret); reason != "" {
+		reasons = append(reasons, reason)
+	}
+
+	return c.appendTimesReasons(reasons, &parsed, now)
+}
+
+// ValidateAndParse works like ValidateToken, but also returns the parsed token when it is valid, e.g. to read its
+// expiration date, without parsing it again. It returns nil for invalid tokens.
+func (c *TokenConfig) ValidateAndParse(token, sessionId string, now time.Time, secret string) (*ParsedToken, bool) {
+	parsed, valid := c.validateToken(token, sessionId, now, secret)
+	if !valid {
+		return nil, false
+	}
+
+	return &parsed, true
+}
+
+// ValidateTokenBytesToken works exactly like ValidateToken for a token read into a byte slice, e.g. from a request body,
+// without converting it to a string. The token is not retained, but must not be modified during the call.
+func (c *TokenConfig) ValidateTokenBytesToken(token []byte, sessionId string, now time.Time, secret string) bool {
+	// the string shares the memory of the slice and does not outlive the call, neither the parsed token nor the
+	// Logger fields keep any part of it
+	return c.ValidateToken(unsafe.String(unsafe.SliceData(token), len(token)), sessionId, now, secret)
+}
+
+// ValidateTokens validates every token for the sessionId at the same index, like ValidateToken, and returns the results
+// in the same order. The HMAC state is keyed once for the whole batch, which is faster than separate calls.
+// It fails with ErrLengthMismatch when the slices have different lengths.
+func (c *TokenConfig) ValidateTokens(tokens, sessionIds []string, now time.Time, secret string) ([]bool, error) {
+	if len(tokens) != len(sessionIds) {
+		return nil, ErrLengthMismatch
+	}
+
+	m := c.getMac()
+	defer c.putMac(m)
+	m.setKey(c.key(secret))
+
+	results := make([]bool, len(tokens))
+	for i, token := range tokens {
+		parsed, reason := c.validate(m, token, sessionIds[i], now, secret)
+		c.report(token, sessionIds[i], &parsed, reason)
+		results[i] = reason == ""
+	}
+
+	return results, nil
+}
+
+// ValidateSignature checks only that the token is well-formed and its HMAC is valid for the session, ignoring its
+// times, e.g. to tell an expired but authentic token from a forged one. It must not be used to accept requests.
+// Like ValidateToken, it fails for an empty secret with StrictSecret.
+func (c *TokenConfig) ValidateSignature(token, sessionId string, secret string) bool {
+	if c.StrictSecret && secret == "" {
+		return false
+	}
+
+	parsed, err := c.parseToken(token)
+	if err != nil {
+		return false
+	}
+
+	return c.checkSignature(nil, &parsed, sessionId, secret) == ""
+}
+
+// ValidateTokenFunc works like ValidateToken, but resolves the secret with secretFn, e.g. per tenant.
+// secretFn is called only for well-formed tokens, and the token is invalid if it returns an error.
+func (c *TokenConfig) ValidateTokenFunc(token, sessionId string, now time.Time, secretFn func(sessionId string) (string, error)) bool {
+	parsed, err := c.parseToken(token)
+	if err != nil {
+		// no secret is needed to reject the token
+		c.report(token, sessionId, &ParsedToken{}, c.rejectMalformed(nil, &parsed, sessionId, "", err))
+		return false
+	}
+
+	secret, err := secretFn(sessionId)
+	if err != nil {
+		return false
+	}
+
+	reason := ReasonEmptySecret
+	if !c.StrictSecret || secret != "" {
+		reason = c.validateParsed(nil, &parsed, sessionId, now, secret)
+	} else {
+		parsed = ParsedToken{}
+	}
+	c.report(token, sessionId, &parsed, reason)
+
+	return reason == ""
+}
+
+// ValidateTokenWithRevocation works like ValidateToken, but also rejects the token when revoked reports its sessionId
+// as revoked, e.g. after logging out of all devices. revoked is called only for tokens that passed all other checks.
+// A revoked token is reported with ReasonRevoked.
+func (c *TokenConfig) ValidateTokenWithRevocation(token, sessionId string, now time.Time, secret string, revoked func(sessionId string) bool) bool {
+	parsed, reason := c.validate(nil, token, sessionId, now, secret)
+	if reason == "" && revoked(sessionId) {
+		reason = ReasonRevoked
+	}
+	c.report(token, sessionId, &parsed, reason)
+
+	return reason == ""
+}
+
+// ValidateWithRemaining works like ValidateToken, but also returns how long the token remains valid, e.g. to refresh it
+// ahead of the expiration. The remaining duration is zero for invalid tokens.
+func (c *TokenConfig) ValidateWithRemaining(token, sessionId string, now time.Time, secret string) (bool, time.Duration) {
+	parsed, valid := c.validateToken(token, sessionId, now, secret)
+	if !valid {
+		return false, 0
+	}
+
+	return true, parsed.ExpiresAt.Add(c.Tolerance).Sub(now)
+}
+
+// validateToken validates the token, notifying Metrics and Logger, and returns the parsed token.
+func (c *TokenConfig) validateToken(token, sessionId string, now time.Time, secret string) (ParsedToken, bool) {
+	parsed, reason := c.validate(nil, token, sessionId, now, secret)
+	c.report(token, sessionId, &parsed, reason)
+
+	return parsed, reason == ""
+}
+
+// validateSecrets validates the token with each of the n secrets returned by secret, and returns the parsed token and
+// the reason why it is invalid, for the caller to report once. All secrets are always checked, even after a match,
+// so the time it takes does not tell which of them matched, nor whether an old secret is still accepted. A token valid for none of them gets the reason of a secret its HMAC
+// matched, e.g. expired, or ReasonMismatch otherwise.
+func (c *TokenConfig) validateSecrets(token, sessionId string, now time.Time, n int, secret func(i int) string) (ParsedToken, string) {
+	var parsed ParsedToken
+	reason := ReasonMismatch
+	for i := 0; i < n; i++ {
+		p, r := c.validate(nil, token, sessionId, now, secret(i))
+		if i == 0 || r == "" || (reason != "" && r != ReasonMismatch) {
+			parsed, reason = p, r
+		}
+	}
+
+	return parsed, reason
+}
+
+// report notifies Metrics, Logger and Slog about the validation result.
+func (c *TokenConfig) report(token, sessionId string, parsed *ParsedToken, reason string) {
+	c.metrics().IncValidated(reason == "", reason)
+	if reason != "" && c.Logger != nil {
+		c.logRejection(token, reason)
+	}
+	if c.Slog != nil {
+		c.logValidation(sessionId, parsed, reason)
+	}
+}
+
+func (c *TokenConfig) logValidation(sessionId string, parsed *ParsedToken, reason string) {
+	ctx := context.Background()
+	if !c.Slog.Enabled(ctx, c.SlogLevel) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.Bool("valid", reason == ""),
+		slog.String("reason", reason),
+		slog.String("session_id_fingerprint", TokenFingerprint(sessionId)),
+	}
+	if !parsed.ExpiresAt.IsZero() {
+		attrs = append(attrs, slog.Time("expires_at", parsed.ExpiresAt))
+	}
+
+	c.Slog.LogAttrs(ctx, c.SlogLevel, "csrf: token validated", attrs...)
+}
+
+func (c *TokenConfig) logRejection(token, reason string) {
+	fields := map[string]any{"reason": reason, "fingerprint": TokenFingerprint(token)}
+	if parsed, err := c.parseToken(token); err == nil {
+		fields["expires_at"] = parsed.ExpiresAt
+	}
+
+	c.Logger("csrf: token rejected", fields)
+}
+
+// validate returns the parsed token and the reason why it is invalid, or an empty string for valid tokens.
+// The HMAC is computed with m, already keyed with the secret, or with a pooled state when m is nil.
+func (c *TokenConfig) validate(m *macState, token, sessionId string, now time.Time, secret string) (ParsedToken, string) {
+	if c.StrictSecret && secret == "" {
+		return ParsedToken{}, ReasonEmptySecret
+	}
+
+	parsed, err := c.parseToken(token)
+	if err != nil {
+		return ParsedToken{}, c.rejectMalformed(m, &parsed, sessionId, secret, err)
+	}
+
+	return parsed, c.validateParsed(m, &parsed, sessionId, now, secret)
+}
+
+// rejectMalformed returns the reason for the parsing error, after computing the HMAC with ConstantTimeReject.
+func (c *TokenConfig) rejectMalformed(m *macState, parsed *ParsedToken, sessionId, secret string, err error) string {
+	if c.ConstantTimeReject {
+		c.checkSignature(m, parsed, sessionId, secret)
+	}
+	if err == ErrUnsupportedVersion {
+		return ReasonUnsupportedVersion
+	}
+
+	return ReasonMalformed
+}
+
+// validateParsed returns the reason why the parsed token is invalid, or an empty string if it is not.
+func (c *TokenConfig) validateParsed(m *macState, parsed *ParsedToken, sessionId string, now time.Time, secret string) string {
+	// the HMAC is checked for every well-formed token, so an expired token takes the same path whether it is authentic
+	// or not, and can't be used to probe which timestamps would be valid if signed
+	signatureReason := c.checkSignature(m, parsed, sessionId, secret)
+	timesReason := c.checkTimes(parsed, now)
+	if signatureReason != "" {
+		return signatureReason
+	}
+
+	return timesReason
+}
+
+// checkSignature returns the reason why the HMAC of the parsed token is invalid, or an empty string if it is not.
+// The HMAC is computed with m, already keyed with the secret, or with a pooled state when m is nil. It is taken from
+// the sample of m instead when it is set.
+func (c *TokenConfig) checkSignature(m *macState, parsed *ParsedToken, sessionId string, secret string) string {
+	if m == nil {
+		m = c.getMac()
+		defer c.putMac(m)
+		m.setKey(c.key(secret))
+	}
+
+	m.buf = c.appendParsedContents(m.buf[:0], sessionId, parsed)
+	var hashSample []byte
+	if m.sample != nil {
+		hashSample = m.sample(m, parsed.ExpiresAt)
+	} else {
+		hashSample = m.keyedHexSum()
+	}
+	m.scratch = c.appendPresentedHash(m.scratch[:0], parsed.Hash)
+
+	match := subtle.ConstantTimeCompare(m.scratch, hashSample)
+	// empty hash is rejected after the comparison, so it can't be told apart from a wrong hash by timing
+	if parsed.Hash == "" {
+		return ReasonMalformed
+	}
+	if match != 1 {
+		return ReasonMismatch
+	}
+
+	return ""
+}
+
+// appendPresentedHash appends the hash of the token to dst, lowercased with CaseInsensitiveHex, so it can be compared
+// with the computed one.
+func (c *TokenConfig) appendPresentedHash(dst []byte, hash string) []byte {
+	start := len(dst)
+	dst = append(dst, hash...)
+	if c.CaseInsensitiveHex {
+		for i, b := range dst[start:] {
+			if b >= 'A' && b <= 'F' {
+				dst[start+i] = b + ('a' - 'A')
+			}
+		}
+	}
+
+	return dst
+}
+
+// checkTimes returns the reason why the token is invalid at the time, or an empty string if it is not.
+func (c *TokenConfig) checkTimes(parsed *ParsedToken, now time.Time) string {
+	var buf [4]string
+	if reasons := c.appendTimesReasons(buf[:0], parsed, now); len(reasons) > 0 {
+		return reasons[0]
+	}
+
+	return ""
+}
+
+// appendTimesReasons appends all reasons why the token is invalid at the time to dst, the most important first.
+func (c *TokenConfig) appendTimesReasons(dst []string, parsed *ParsedToken, now time.Time) []string {
+	if c.Versioned && parsed.Version != tokenVersion && !now.Before(c.LegacyUntil) {
+		dst = append(dst, ReasonUnsupportedVersion)
+	}
+
+	// expiration is in the past (before now)
+	if parsed.ExpiresAt.Add(c.Tolerance).Before(now) {
+		dst = append(dst, ReasonExpired)
+	}
+
+	if c.IncludeIssuedAt {
+		// issued in the future (after now)
+		if parsed.IssuedAt.Add(-c.Tolerance).After(now) {
+			dst = append(dst, ReasonIssuedInFuture)
+		}
+		if c.MaxAge > 0 && parsed.IssuedAt.Add(c.MaxAge).Before(now) {
+			dst = append(dst, ReasonTooOld)
+		}
+	}
+
+	return dst
+}
+
+// ParseToken splits the token into its segments without validating it.
+// It fails with ErrMalformedToken when the token does not have the segments required by the config (ErrWrongSegments),
+// its timestamps are not numeric (ErrBadTimestamp) or its hash is empty, and with ErrUnsupportedVersion for an unknown
+// version.
+func (c *TokenConfig) ParseToken(token string) (*ParsedToken, error) {
+	parsed, err := c.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Hash == "" {
+		return nil, ErrMalformedToken
+	}
+
+	return &parsed, nil
+}
+
+// parseToken works like ParseToken, but accepts an empty hash segment.
+// It splits the token by slicing, so it doesn't allocate.
+func (c *TokenConfig) parseToken(token string) (ParsedToken, error) {
+	var parsed ParsedToken
+
+	if c.TrimInput {
+		token = strings.Trim(token, " \t\n\v\f\r")
+	}
+	if max := c.maxTokenLength(); max >= 0 && len(token) > max {
+		return parsed, ErrTokenTooLong
+	}
+
+	rest := token
+	// hashes are hex encoded, so only versioned tokens start with "v"
+	if c.Versioned && strings.HasPrefix(rest, "v") {
+		var version string
+		if c.FixedWidth {
+			// there is no separator, so only the known versions can be recognised
+			if strings.HasPrefix(rest, tokenVersion) || strings.HasPrefix(rest, legacyTokenVersion) {
+				version = rest[:len(tokenVersion)]
+			}
+		} else if i := strings.Index(rest, TokenTimestampSeparator); i >= 0 {
+			version = rest[:i]
+		}
+		if version != tokenVersion && version != legacyTokenVersion {
+			return parsed, ErrUnsupportedVersion
+		}
+		parsed.Version, rest = version, rest[len(version)+len(c.separator()):]
+	}
+
+	if c.FixedWidth {
+		return c.parseFixedWidth(parsed, rest)
+	}
+
+	var ok bool
+	if c.TimestampFirst {
+		if parsed.RawTimestamp, rest, ok = c.cutFirstTimestamp(rest); !ok {
+			return parsed, ErrWrongSegments
+		}
+		if c.IncludeIssuedAt {
+			if parsed.rawIssuedAt, rest, ok = c.cutFirstTimestamp(rest); !ok {
+				return parsed, ErrWrongSegments
+			}
+		}
+		parsed.Hash = rest
+	} else {
+		if c.IncludeIssuedAt {
+			if rest, parsed.rawIssuedAt, ok = c.cutLastTimestamp(rest); !ok {
+				return parsed, ErrWrongSegments
+			}
+		}
+		if parsed.Hash, parsed.RawTimestamp, ok = c.cutLastTimestamp(rest); !ok {
+			return parsed, ErrWrongSegments
+		}
+	}
+
+	parsed, err := c.parseTimestamps(parsed)
+	// the hash is hex encoded, so a token split with another separator than it was generated with, e.g. after
+	// TokenTimestampSeparator changed, is malformed rather than merely mismatched
+	if err == nil && !isHex(parsed.Hash, c.CaseInsensitiveHex) {
+		return parsed, ErrWrongSegments
+	}
+
+	return parsed, err
+}
+
+// cutFirstTimestamp cuts the first timestamp segment and the separator following it off the rest of the token.
+// Decimal timestamps never contain the separator, so its first occurrence isolates them even if the hash contains it.
+// Opaque and debug timestamps may contain it, e.g. "--" in base64url or ":" in RFC 3339, so they are cut at their fixed
+// width, where the separator has to appear exactly. Otherwise they are cut at the first separator, so the timestamp
+// fails to parse.
+func (c *TokenConfig) cutFirstTimestamp(rest string) (timestamp, after string, ok bool) {
+	if width := c.timestampLength(); c.fixedWidthTimestamps() && len(rest) >= width &&
+		strings.HasPrefix(rest[width:], TokenTimestampSeparator) {
+		return rest[:width], rest[width+len(TokenTimestampSeparator):], true
+	}
+
+	return strings.Cut(rest, TokenTimestampSeparator)
+}
+
+// cutLastTimestamp works like cutFirstTimestamp, cutting the last timestamp segment and the separator preceding it.
+func (c *TokenConfig) cutLastTimestamp(rest string) (before, timestamp string, ok bool) {
+	i := len(rest) - c.timestampLength() - len(TokenTimestampSeparator)
+	if !c.fixedWidthTimestamps() || i < 0 || !strings.HasPrefix(rest[i:], TokenTimestampSeparator) {
+		if i = strings.LastIndex(rest, TokenTimestampSeparator); i < 0 {
+			return "", "", false
+		}
+	}
+
+	return rest[:i], rest[i+len(TokenTimestampSeparator):], true
+}
+
+// isHex reports whether s consists of lowercase hex digits only, or also uppercase ones when upper is set.
+func isHex(s string, upper bool) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') && (!upper || s[i] < 'A' || s[i] > 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseFixedWidth splits the rest of a FixedWidth token at the offsets given by the hash size and timestamp width.
+func (c *TokenConfig) parseFixedWidth(parsed ParsedToken, rest string) (ParsedToken, error) {
+	hashLength, timestampsLength := hex.EncodedLen(c.hash().Size()), c.timestampCount()*c.timestampLength()
+	if len(rest) != hashLength+timestampsLength {
+		return parsed, ErrWrongSegments
+	}
+
+	if c.TimestampFirst {
+		rest, parsed.Hash = rest[:timestampsLength], rest[timestampsLength:]
+	} else {
+		parsed.Hash, rest = rest[:hashLength], rest[hashLength:]
+	}
+	parsed.RawTimestamp, rest = rest[:c.timestampLength()], rest[c.timestampLength():]
+	if c.IncludeIssuedAt {
+		parsed.rawIssuedAt = rest
+	}
+
+	return c.parseTimestamps(parsed)
+}
+
+// parseTimestamps parses the raw timestamps of the token.
+func (c *TokenConfig) parseTimestamps(parsed ParsedToken) (ParsedToken, error) {
+	var err error
+	if parsed.ExpiresAt, err = c.parseTimestamp(parsed.RawTimestamp); err != nil {
+		return parsed, err
+	}
+
+	if c.IncludeIssuedAt {
+		if parsed.IssuedAt, err = c.parseTimestamp(parsed.rawIssuedAt); err != nil {
+			return parsed, err
+		}
+		if c.RelativeExpiry {
+			parsed.ExpiresAt = parsed.IssuedAt.Add(time.Duration(parsed.ExpiresAt.Unix()) * time.Second)
+			if parsed.ExpiresAt.After(c.horizon()) {
+				return parsed, ErrBadTimestamp
+			}
+		}
+	}
+
+	return parsed, nil
+}
+
+// appendPrefix appends the Prefix, preceded by its length, to the HMAC input.
+func (c *TokenConfig) appendPrefix(dst []byte) []byte {
+	if c.Prefix == "" {
+		return dst
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(c.Prefix)))
+
+	return append(dst, c.Prefix...)
+}
+
+// maxTokenLength returns MaxTokenLength, or twice the TokenLength when it is zero.
+func (c *TokenConfig) maxTokenLength() int {
+	if c.MaxTokenLength == 0 {
+		return 2 * c.TokenLength()
+	}
+
+	return c.MaxTokenLength
+}
+
+// separator returns the separator between the token segments, none for FixedWidth tokens.
+func (c *TokenConfig) separator() string {
+	if c.FixedWidth {
+		return ""
+	}
+
+	return TokenTimestampSeparator
+}
+
+// timestampCount returns the number of timestamps in the token.
+func (c *TokenConfig) timestampCount() int {
+	if c.IncludeIssuedAt {
+		return 2
+	}
+
+	return 1
+}
+
+// TokenLength returns the maximum length of tokens generated with the config, e.g. to size a database column.
+// The sessionId is not part of the token, so it doesn't affect the length. Decimal timestamps are assumed to be
+// dates before year 10000.
+func (c *TokenConfig) TokenLength() int {
+	length := hex.EncodedLen(c.hash().Size())
+	if c.Versioned {
+		length += len(tokenVersion) + len(c.separator())
+	}
+
+	return length + c.timestampCount()*(len(c.separator())+c.timestampLength())
+}
+
+// HashInfo returns the name of the MAC algorithm used by the config, e.g. "HMAC-SHA-512/224", and the size of the MAC
+// in bytes, e.g. to display the configuration.
+func (c *TokenConfig) HashInfo() (name string, outputBytes int) {
+	h := c.hash()
+	if c.MACMode == BLAKE2Keyed {
+		return "BLAKE2b-512 keyed", h.Size()
+	}
+
+	return "HMAC-" + h.String(), h.Size()
+}
+
+// SecurityBits returns the forgery resistance of the tokens in bits, i.e. the size of the MAC, e.g. 224 for
+// HMAC-SHA-512/224 and 256 for HMAC-SHA-256. It does not account for the strength of the secret.
+func (c *TokenConfig) SecurityBits() int {
+	return c.hash().Size() * 8
+}
+
+// checkSecret returns ErrEmptySecret for an empty secret in StrictSecret mode, and ErrWeakSecret when the secret is
+// shorter than MinSecretLength.
+func (c *TokenConfig) checkSecret(secret string) error {
+	if c.StrictSecret && secret == "" {
+		return ErrEmptySecret
+	}
+	if len(secret) < c.MinSecretLength {
+		return fmt.Errorf("%w: %d bytes, at least %d required", ErrWeakSecret, len(secret), c.MinSecretLength)
+	}
+
+	return nil
+}
+
+// key returns the HMAC key for the secret, derived with PBKDF2 when StretchSecret is set.
+func (c *TokenConfig) key(secret string) string {
+	if !c.StretchSecret {
+		return secret
+	}
+	if key, ok := c.stretched.Load(secret); ok {
+		return key.(string)
+	}
+
+	iterations, salt := c.StretchIterations, c.StretchSalt
+	if iterations == 0 {
+		iterations = defaultStretchIterations
+	}
+	if salt == "" {
+		salt = defaultStretchSalt
+	}
+
+	key, err := pbkdf2.Key(sha256.New, secret, []byte(salt), iterations, sha256.Size)
+	if err != nil {
+		panic(err)
+	}
+	// the secret may be a view of a buffer wiped later, e.g. by Manager.Close
+	stretched, _ := c.stretched.LoadOrStore(strings.Clone(secret), string(key))
+
+	return stretched.(string)
+}
+
+// version returns the format version of the generated tokens, empty unless Versioned.
+func (c *TokenConfig) version() string {
+	if c.Versioned {
+		return tokenVersion
+	}
+
+	return ""
+}
+
+func (c *TokenConfig) metrics() Metrics {
+	if c.Metrics == nil {
+		return noopMetrics{}
+	}
+
+	return c.Metrics
+}
+
+func (c *TokenConfig) hash() crypto.Hash {
+	if c.MACMode == BLAKE2Keyed {
+		return crypto.BLAKE2b_512
+	}
+	if c.Hash == 0 {
+		return crypto.SHA512_224
+	}
+
+	return c.Hash
+}
+
+// getMac returns a pooled state computing the MAC of the config.
+func (c *TokenConfig) getMac() *macState {
+	return getMacMode(c.hash(), c.MACMode)
+}
+
+func (c *TokenConfig) putMac(m *macState) {
+	putMacMode(c.hash(), c.MACMode, m)
+}
+
+func (c *TokenConfig) horizon() time.Time {
+	if c.Horizon.IsZero() {
+		return defaultHorizon
+	}
+
+	return c.Horizon
+}
+
+func (c *TokenConfig) now() time.Time {
+	if c.Clock == nil {
+		return systemClock{}.Now()
+	}
+
+	return c.Clock.Now()
+}
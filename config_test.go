@@ -0,0 +1,1053 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha3"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	_ "golang.org/x/crypto/blake2b"
+)
+
+func TestValidTokenWithIssuedAtFlow(t *testing.T) {
+	config := &TokenConfig{IncludeIssuedAt: true, MaxAge: 10 * time.Minute}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+
+	if len(strings.Split(token, TokenTimestampSeparator)) != 3 {
+		t.Errorf("token was expected to have 3 segments: token=%s", token)
+	}
+
+	if !config.ValidateToken(token, sessionId, now.Add(time.Second), secret) {
+		t.Errorf("token validation failed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, now)
+	}
+}
+
+func TestTokenIssuedInTheFutureIsInvalid(t *testing.T) {
+	config := &TokenConfig{IncludeIssuedAt: true}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+
+	validatedAt := now.Add(-time.Minute)
+
+	if config.ValidateToken(token, sessionId, validatedAt, secret) {
+		t.Errorf("token validation was expected to fail, but passed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, validatedAt)
+	}
+}
+
+func TestTokenOlderThanMaxAgeIsInvalid(t *testing.T) {
+	config := &TokenConfig{IncludeIssuedAt: true, MaxAge: 5 * time.Minute}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(time.Hour)
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+
+	validatedAt := now.Add(10 * time.Minute)
+
+	if config.ValidateToken(token, sessionId, validatedAt, secret) {
+		t.Errorf("token validation was expected to fail, but passed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, validatedAt)
+	}
+}
+
+func TestTokenWithoutIssuedAtIsInvalidWhenIssuedAtIsRequired(t *testing.T) {
+	config := &TokenConfig{IncludeIssuedAt: true}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := GenerateToken(sessionId, expireAt, secret)
+
+	if config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token validation was expected to fail, but passed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, now)
+	}
+}
+
+func TestValidTokenFlowWithOtherHashes(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA3_256, crypto.BLAKE2b_512} {
+		config := &TokenConfig{Hash: hash}
+
+		token := config.GenerateToken(sessionId, expireAt, secret)
+
+		if len(strings.Split(token, TokenTimestampSeparator)[0]) != 2*hash.Size() {
+			t.Errorf("unexpected hash length for %s: token=%s", hash, token)
+		}
+
+		if !config.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("token validation failed for %s: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", hash, token, sessionId, expireAt, secret, now)
+		}
+	}
+}
+
+func TestTokenWithDifferentHashIsInvalid(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+	hashes := []crypto.Hash{crypto.SHA512_224, crypto.SHA3_256, crypto.BLAKE2b_512}
+
+	for _, generatedWith := range hashes {
+		token := (&TokenConfig{Hash: generatedWith}).GenerateToken(sessionId, expireAt, secret)
+
+		for _, validatedWith := range hashes {
+			if generatedWith == validatedWith {
+				continue
+			}
+
+			if (&TokenConfig{Hash: validatedWith}).ValidateToken(token, sessionId, now, secret) {
+				t.Errorf("token generated with %s was expected to be invalid with %s: token=%s", generatedWith, validatedWith, token)
+			}
+		}
+	}
+}
+
+func TestValidVersionedTokenFlow(t *testing.T) {
+	config := &TokenConfig{Versioned: true}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+
+	if !strings.HasPrefix(token, "v2"+TokenTimestampSeparator) {
+		t.Errorf("token was expected to start with the version: token=%s", token)
+	}
+
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token validation failed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, now)
+	}
+}
+
+func TestTokenWithUnknownVersionIsInvalid(t *testing.T) {
+	config := &TokenConfig{Versioned: true}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := "v9" + strings.TrimPrefix(config.GenerateToken(sessionId, expireAt, secret), "v2")
+
+	if config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token validation was expected to fail, but passed: token=%s", token)
+	}
+
+	if _, err := config.ParseToken(token); err != ErrUnsupportedVersion {
+		t.Errorf("token parsing was expected to fail with ErrUnsupportedVersion, got: %v", err)
+	}
+}
+
+func TestLegacyTokenIsValidOnlyDuringLegacyWindow(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(time.Hour)
+	config := &TokenConfig{Versioned: true, LegacyUntil: now.Add(10 * time.Minute)}
+
+	token := GenerateToken(sessionId, expireAt, secret)
+
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("legacy token validation failed during the legacy window: token=%s", token)
+	}
+
+	if config.ValidateToken(token, sessionId, now.Add(20*time.Minute), secret) {
+		t.Errorf("legacy token validation was expected to fail after the legacy window, but passed: token=%s", token)
+	}
+
+	if (&TokenConfig{Versioned: true}).ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("legacy token validation was expected to fail without the legacy window, but passed: token=%s", token)
+	}
+}
+
+func TestVersionedTokenIsCoveredByDomainTag(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(time.Hour)
+	config := &TokenConfig{Versioned: true, LegacyUntil: now.Add(10 * time.Minute)}
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+	untagged := strings.TrimPrefix(token, "v2"+TokenTimestampSeparator)
+
+	if ValidateToken(untagged, sessionId, now, secret) {
+		t.Errorf("tagged token was expected to be invalid for validator without the tag: token=%s", untagged)
+	}
+	if config.ValidateToken("v1"+TokenTimestampSeparator+untagged, sessionId, now, secret) {
+		t.Errorf("tagged token was expected to be invalid as v1 token: token=%s", token)
+	}
+	if hash := strings.Split(untagged, TokenTimestampSeparator)[0]; hash == strings.Split(GenerateToken(sessionId, expireAt, secret), TokenTimestampSeparator)[0] {
+		t.Errorf("tagged HMAC was expected to differ from untagged one")
+	}
+}
+
+func TestV1TokenIsValidOnlyDuringLegacyWindow(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	config := &TokenConfig{Versioned: true, LegacyUntil: now.Add(10 * time.Minute)}
+
+	// v1 tokens were versioned tokens without the domain tag
+	token := "v1" + TokenTimestampSeparator + GenerateToken(sessionId, now.Add(time.Hour), secret)
+
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("v1 token validation failed during the legacy window: token=%s", token)
+	}
+	if config.ValidateToken(token, sessionId, now.Add(20*time.Minute), secret) {
+		t.Errorf("v1 token validation was expected to fail after the legacy window, but passed: token=%s", token)
+	}
+
+	fixed := &TokenConfig{Versioned: true, FixedWidth: true, LegacyUntil: now.Add(10 * time.Minute)}
+	fixedToken := "v1" + (&TokenConfig{FixedWidth: true}).GenerateToken(sessionId, now.Add(time.Hour), secret)
+	if !fixed.ValidateToken(fixedToken, sessionId, now, secret) {
+		t.Errorf("FixedWidth v1 token validation failed during the legacy window: token=%s", fixedToken)
+	}
+}
+
+func TestHashAlgorithmIsCoveredByHmac(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+	sha256Config := &TokenConfig{Hash: crypto.SHA256}
+	defaultConfig := &TokenConfig{}
+
+	sha256Token := sha256Config.GenerateToken(sessionId, expireAt, secret)
+	defaultToken := defaultConfig.GenerateToken(sessionId, expireAt, secret)
+
+	if defaultConfig.ValidateToken(sha256Token, sessionId, now, secret) {
+		t.Errorf("SHA-256 token was expected to be invalid with SHA-512/224: token=%s", sha256Token)
+	}
+	if sha256Config.ValidateToken(defaultToken, sessionId, now, secret) {
+		t.Errorf("SHA-512/224 token was expected to be invalid with SHA-256: token=%s", defaultToken)
+	}
+
+	// the same HMAC without the algorithm identifier
+	parts := strings.Split(sha256Token, TokenTimestampSeparator)
+	m := getMac(crypto.SHA256)
+	m.algorithm, m.buf = nil, []byte(tokenContents(sessionId, parts[1]))
+	unidentified := string(m.hexSum(secret))
+
+	if unidentified == parts[0] {
+		t.Errorf("SHA-256 HMAC was expected to cover the algorithm identifier")
+	}
+}
+
+func TestLoggerIsCalledOnRejection(t *testing.T) {
+	var logged []string
+	config := &TokenConfig{Logger: func(msg string, fields map[string]any) {
+		logged = append(logged, fmt.Sprint(msg, fields))
+	}}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(-5 * time.Minute)
+
+	config.ValidateToken(config.GenerateToken(sessionId, now.Add(5*time.Minute), secret), sessionId, now, secret)
+	if len(logged) != 0 {
+		t.Errorf("valid token was not expected to be logged: %v", logged)
+	}
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+	config.ValidateToken(token, sessionId, now, secret)
+
+	if len(logged) != 1 {
+		t.Fatalf("one rejection was expected to be logged: %v", logged)
+	}
+	if !strings.Contains(logged[0], "reason:"+ReasonExpired) || !strings.Contains(logged[0], "expires_at:"+time.Unix(expireAt.Unix(), 0).String()) {
+		t.Errorf("log entry was expected to contain the reason and the expiration date: %s", logged[0])
+	}
+	if !strings.Contains(logged[0], "fingerprint:"+TokenFingerprint(token)) {
+		t.Errorf("log entry was expected to contain the token fingerprint: %s", logged[0])
+	}
+	if strings.Contains(logged[0], secret) || strings.Contains(logged[0], strings.Split(token, TokenTimestampSeparator)[0]) {
+		t.Errorf("log entry was not expected to contain the secret or the hash: %s", logged[0])
+	}
+}
+
+func TestSlogRecordsValidations(t *testing.T) {
+	var buf bytes.Buffer
+	config := &TokenConfig{
+		Slog:      slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		SlogLevel: slog.LevelDebug,
+	}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := time.Unix(now.Add(5*time.Minute).Unix(), 0)
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+	config.ValidateToken(token, sessionId, now, secret)
+	config.ValidateToken(token, "user2-login", now, secret)
+	config.ValidateToken("malformed", sessionId, now, secret)
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("every validation was expected to be recorded, got: %s", buf.String())
+	}
+
+	expected := []struct {
+		valid     bool
+		reason    string
+		sessionId string
+		expiresAt bool
+	}{
+		{true, "", sessionId, true},
+		{false, ReasonMismatch, "user2-login", true},
+		{false, ReasonMalformed, sessionId, false},
+	}
+	for i, e := range expected {
+		record := records[i]
+		if record["level"] != "DEBUG" || record["valid"] != e.valid || record["reason"] != e.reason {
+			t.Errorf("record %d does not match, got: %v", i, record)
+		}
+		if record["session_id_fingerprint"] != TokenFingerprint(e.sessionId) {
+			t.Errorf("record %d was expected to contain the sessionId fingerprint, got: %v", i, record)
+		}
+		if _, ok := record["expires_at"]; ok != e.expiresAt {
+			t.Errorf("record %d was expected to contain expires_at: %v, got: %v", i, e.expiresAt, record)
+		}
+	}
+	if record := records[0]["expires_at"]; record != expireAt.Format(time.RFC3339Nano) {
+		t.Errorf("expires_at was expected to be %s, got: %v", expireAt.Format(time.RFC3339Nano), record)
+	}
+
+	for _, sensitive := range []string{secret, token, strings.Split(token, TokenTimestampSeparator)[0], "user1-login"} {
+		if strings.Contains(buf.String(), sensitive) {
+			t.Errorf("records were not expected to contain %q: %s", sensitive, buf.String())
+		}
+	}
+}
+
+func TestSlogRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	config := &TokenConfig{Slog: slog.New(slog.NewJSONHandler(&buf, nil)), SlogLevel: slog.LevelDebug}
+
+	config.ValidateToken("malformed", "user1-login", time.Now(), "LoremIpsum123")
+
+	if buf.Len() != 0 {
+		t.Errorf("records below the logger level were not expected: %s", buf.String())
+	}
+}
+
+func TestTokenWithSurroundingWhitespaceIsValidOnlyWithTrimInput(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := GenerateToken(sessionId, expireAt, secret)
+
+	for _, padded := range []string{token + "\n", " " + token + "\r\n", "\t" + token} {
+		if !(&TokenConfig{TrimInput: true}).ValidateToken(padded, sessionId, now, secret) {
+			t.Errorf("token validation with TrimInput failed: token=%q", padded)
+		}
+
+		if (&TokenConfig{}).ValidateToken(padded, sessionId, now, secret) {
+			t.Errorf("token validation without TrimInput was expected to fail, but passed: token=%q", padded)
+		}
+	}
+}
+
+func TestValidOpaqueTimestampTokenFlow(t *testing.T) {
+	config := &TokenConfig{OpaqueTimestamp: true}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := config.GenerateToken(sessionId, expireAt, secret)
+
+	if strings.Contains(token, strconv.FormatInt(expireAt.Unix(), 10)) {
+		t.Errorf("token was not expected to contain the plain expiration date: token=%s", token)
+	}
+	if token != config.GenerateToken(sessionId, expireAt, secret) {
+		t.Errorf("opaque timestamps were expected to be deterministic: token=%s", token)
+	}
+
+	parsed, err := config.ParseToken(token)
+	if err != nil || parsed.ExpiresAt.Unix() != expireAt.Unix() {
+		t.Errorf("token parsing was expected to reverse the expiration date: parsed=%v, err=%v", parsed, err)
+	}
+
+	if !config.ValidateToken(token, sessionId, now.Add(time.Second), secret) {
+		t.Errorf("token validation failed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, now)
+	}
+	if config.ValidateToken(token, sessionId, now.Add(10*time.Minute), secret) {
+		t.Errorf("expired token validation was expected to fail, but passed: token=%s", token)
+	}
+}
+
+func TestOpaqueAndDecimalTimestampsAreNotCrossAccepted(t *testing.T) {
+	opaque := &TokenConfig{OpaqueTimestamp: true}
+	decimal := &TokenConfig{}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	if decimal.ValidateToken(opaque.GenerateToken(sessionId, expireAt, secret), sessionId, now, secret) {
+		t.Errorf("opaque timestamp token was expected to be invalid in decimal mode")
+	}
+	if opaque.ValidateToken(decimal.GenerateToken(sessionId, expireAt, secret), sessionId, now, secret) {
+		t.Errorf("decimal timestamp token was expected to be invalid in opaque mode")
+	}
+}
+
+func TestTokenLength(t *testing.T) {
+	latest := time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+	if length := len(GenerateToken("user1-login", latest, "LoremIpsum123")); length != TokenLength() {
+		t.Errorf("expected TokenLength to be %d, got: %d", length, TokenLength())
+	}
+	if length := len(GenerateToken("user1-login", time.Now(), "LoremIpsum123")); length > TokenLength() {
+		t.Errorf("token of length %d exceeds TokenLength %d", length, TokenLength())
+	}
+
+	configs := []*TokenConfig{
+		{Hash: crypto.SHA256},
+		{IncludeIssuedAt: true, Versioned: true},
+		{OpaqueTimestamp: true, Hash: crypto.SHA3_512},
+	}
+	for _, config := range configs {
+		config.Clock = &FixedClock{Time: latest}
+		if length := len(config.GenerateToken("user1-login", latest, "LoremIpsum123")); length != config.TokenLength() {
+			t.Errorf("expected TokenLength to be %d for %+v, got: %d", length, config, config.TokenLength())
+		}
+	}
+}
+
+func TestTokenConfigFixedWidth(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	configs := []*TokenConfig{
+		{FixedWidth: true},
+		{FixedWidth: true, IncludeIssuedAt: true, Versioned: true},
+		{FixedWidth: true, OpaqueTimestamp: true, Hash: crypto.SHA256},
+	}
+	for _, config := range configs {
+		token := config.GenerateToken(sessionId, now.Add(time.Minute), secret)
+
+		if strings.Contains(token, TokenTimestampSeparator) {
+			t.Errorf("token was expected to have no separator, got: %s", token)
+		}
+		if len(token) != config.TokenLength() {
+			t.Errorf("token was expected to have fixed length %d, got: %d", config.TokenLength(), len(token))
+		}
+		if !config.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("token was expected to be valid for %+v: %s", config, token)
+		}
+		if config.ValidateToken(token, "user2-login", now, secret) {
+			t.Errorf("token was expected to be invalid for other session")
+		}
+		if config.ValidateToken(token, sessionId, now.Add(2*time.Minute), secret) {
+			t.Errorf("token was expected to be expired")
+		}
+		if config.ValidateToken(token[:len(token)-1], sessionId, now, secret) {
+			t.Errorf("truncated token was expected to be invalid")
+		}
+	}
+}
+
+func TestTokenConfigFixedWidthIsNotCrossAccepted(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	fixed := &TokenConfig{FixedWidth: true}
+
+	dotted := GenerateToken(sessionId, now.Add(time.Minute), secret)
+	if fixed.ValidateToken(dotted, sessionId, now, secret) {
+		t.Errorf("dotted token was expected to be rejected by FixedWidth config")
+	}
+
+	compact := fixed.GenerateToken(sessionId, now.Add(time.Minute), secret)
+	if ValidateToken(compact, sessionId, now, secret) {
+		t.Errorf("FixedWidth token was expected to be rejected by default config")
+	}
+
+	// the same hash re-shaped into the other format must not validate either
+	parsed, _ := fixed.ParseToken(compact)
+	reshaped := parsed.Hash + TokenTimestampSeparator + strconv.FormatInt(parsed.ExpiresAt.Unix(), 10)
+	if ValidateToken(reshaped, sessionId, now, secret) {
+		t.Errorf("reshaped FixedWidth token was expected to be rejected by default config")
+	}
+}
+
+func TestGenerateTokenSafe(t *testing.T) {
+	config := &TokenConfig{MinSecretLength: DefaultMinSecretLength}
+	expireAt := time.Now().Add(time.Minute)
+
+	if token, err := config.GenerateTokenSafe("user1-login", expireAt, "LoremIpsum123"); !errors.Is(err, ErrWeakSecret) || token != "" {
+		t.Errorf("short secret was expected to be rejected with ErrWeakSecret, got: %q, %v", token, err)
+	}
+
+	secret := strings.Repeat("LoremIpsum123", 3)
+	token, err := config.GenerateTokenSafe("user1-login", expireAt, secret)
+	if err != nil {
+		t.Fatalf("adequate secret was expected to be accepted, got: %s", err)
+	}
+	if !config.ValidateToken(token, "user1-login", time.Now(), secret) {
+		t.Errorf("token was expected to be valid")
+	}
+}
+
+func TestGenerateTokenSafeRejectsZeroExpiry(t *testing.T) {
+	config := &TokenConfig{}
+
+	if token, err := config.GenerateTokenSafe("user1-login", time.Time{}, "LoremIpsum123"); err != ErrZeroExpiry || token != "" {
+		t.Errorf("zero expiration date was expected to be rejected with ErrZeroExpiry, got: %q, %v", token, err)
+	}
+	if token := config.GenerateToken("user1-login", time.Time{}, "LoremIpsum123"); token == "" {
+		t.Errorf("GenerateToken was expected to keep generating tokens for the zero expiration date")
+	}
+}
+
+func TestTokenConfigRelativeExpiry(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	issuedAt := time.Unix(1609787986, 0)
+	clock := &FixedClock{Time: issuedAt}
+	config := &TokenConfig{IncludeIssuedAt: true, RelativeExpiry: true, Clock: clock}
+
+	token := config.GenerateToken(sessionId, issuedAt.Add(5*time.Minute), secret)
+
+	parsed, err := config.ParseToken(token)
+	if err != nil {
+		t.Fatalf("token was expected to parse: %s", err)
+	}
+	if parsed.RawTimestamp != "300" {
+		t.Errorf("expiration date was expected to be relative to the issuance, got: %s", parsed.RawTimestamp)
+	}
+	if !parsed.ExpiresAt.Equal(issuedAt.Add(5 * time.Minute)) {
+		t.Errorf("expected absolute expiration date %s, got: %s", issuedAt.Add(5*time.Minute), parsed.ExpiresAt)
+	}
+
+	clock.Time = issuedAt.Add(5 * time.Minute)
+	if !config.ValidateTokenNow(token, sessionId, secret) {
+		t.Errorf("token was expected to be valid until its expiration")
+	}
+
+	clock.Time = issuedAt.Add(5*time.Minute + time.Second)
+	if config.ValidateTokenNow(token, sessionId, secret) {
+		t.Errorf("token was expected to expire at %s", issuedAt.Add(5*time.Minute))
+	}
+
+	if (&TokenConfig{IncludeIssuedAt: true}).ValidateToken(token, sessionId, issuedAt, secret) {
+		t.Errorf("relative token was expected to be expired for config without RelativeExpiry")
+	}
+}
+
+func TestTokenConfigPrefix(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	appA := &TokenConfig{Prefix: "appA"}
+	appB := &TokenConfig{Prefix: "appB"}
+
+	token := appA.GenerateToken(sessionId, now.Add(time.Minute), secret)
+
+	if !appA.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token was expected to be valid with the matching prefix")
+	}
+	if appB.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token was expected to be invalid with other prefix")
+	}
+	if ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token was expected to be invalid without prefix")
+	}
+	if !NewCachingValidator(appA, secret, 10).ValidateToken(token, sessionId, now) {
+		t.Errorf("token was expected to be valid for caching validator with the matching prefix")
+	}
+
+	// the label can't be moved between the prefix and the sessionId
+	split := (&TokenConfig{Prefix: "app"}).GenerateToken("A"+sessionId, now.Add(time.Minute), secret)
+	if appA.ValidateToken(split, sessionId, now, secret) {
+		t.Errorf("token was expected to be invalid for a different split of the prefix and sessionId")
+	}
+}
+
+func TestTokenConfigStretchSecret(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	stretched := &TokenConfig{StretchSecret: true, StretchIterations: 1000, StretchSalt: "lorem-app"}
+
+	token := stretched.GenerateToken(sessionId, now.Add(time.Minute), secret)
+
+	if !stretched.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token was expected to be valid with the stretched secret")
+	}
+	if ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("stretched token was expected to be invalid without stretching")
+	}
+	if stretched.ValidateToken(GenerateToken(sessionId, now.Add(time.Minute), secret), sessionId, now, secret) {
+		t.Errorf("token without stretching was expected to be invalid with stretching")
+	}
+	otherSalt := &TokenConfig{StretchSecret: true, StretchIterations: 1000, StretchSalt: "ipsum-app"}
+	if otherSalt.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("stretched token was expected to be invalid with other salt")
+	}
+}
+
+func TestTokenConfigStretchSecretIsCached(t *testing.T) {
+	config := &TokenConfig{StretchSecret: true, StretchIterations: 1000}
+
+	first := config.key("LoremIpsum123")
+	config.StretchIterations = 2000
+	if second := config.key("LoremIpsum123"); second != first {
+		t.Errorf("stretched key was expected to be derived once and cached")
+	}
+	if config.key("DolorSitAmet456") == first {
+		t.Errorf("stretched keys of different secrets were expected to differ")
+	}
+}
+
+func BenchmarkValidateTokenStretchSecret(b *testing.B) {
+	config := &TokenConfig{StretchSecret: true}
+	token := config.GenerateToken("user1-login", time.Now().Add(time.Hour), "LoremIpsum123")
+	now := time.Now()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		config.ValidateToken(token, "user1-login", now, "LoremIpsum123")
+	}
+}
+
+func TestExpiredTokensTakeTheSamePathRegardlessOfAuthenticity(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(-time.Minute)
+
+	var computed int
+	testHookHMAC = func() { computed++ }
+	defer func() { testHookHMAC = nil }()
+
+	tokens := map[string]string{
+		"authentic": GenerateToken(sessionId, expireAt, secret),
+		"forged":    GenerateToken(sessionId, expireAt, "DolorSitAmet456"),
+	}
+	for name, token := range tokens {
+		computed = 0
+
+		if ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("expired %s token was expected to be invalid", name)
+		}
+		if computed != 1 {
+			t.Errorf("HMAC of expired %s token was expected to be computed once, computed: %d", name, computed)
+		}
+	}
+}
+
+func TestTokenConfigExpiryJitter(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Unix(1609787986, 0)
+	expireAt := now.Add(time.Hour)
+	jitter := 10 * time.Minute
+	config := &TokenConfig{ExpiryJitter: jitter, jitter: rand.New(rand.NewPCG(1, 2)).Int64N}
+
+	expiries := make(map[time.Time]bool)
+	for i := 0; i < 100; i++ {
+		token := config.GenerateToken(sessionId, expireAt, secret)
+
+		parsed, err := config.ParseToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.ExpiresAt.Before(expireAt.Add(-jitter)) || parsed.ExpiresAt.After(expireAt) {
+			t.Errorf("expiration date %s was expected to be within [%s, %s]", parsed.ExpiresAt, expireAt.Add(-jitter), expireAt)
+		}
+		if !config.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("token with jittered expiration date was expected to be valid: %s", token)
+		}
+		expiries[parsed.ExpiresAt] = true
+	}
+
+	if len(expiries) < 50 {
+		t.Errorf("expiration dates were expected to be spread, got %d distinct ones", len(expiries))
+	}
+}
+
+func TestTokenConfigStrictSecret(t *testing.T) {
+	sessionId := "user1-login"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(time.Minute), "")
+
+	if !ValidateToken(token, sessionId, now, "") {
+		t.Errorf("empty secret was expected to be accepted in lenient mode")
+	}
+
+	metrics := &fakeMetrics{}
+	strict := &TokenConfig{StrictSecret: true, Metrics: metrics}
+	if strict.ValidateToken(token, sessionId, now, "") {
+		t.Errorf("empty secret was expected to be rejected in strict mode")
+	}
+	if len(metrics.validated) != 1 || metrics.validated[0] != ReasonEmptySecret {
+		t.Errorf("rejection was expected to be reported with ReasonEmptySecret, got: %v", metrics.validated)
+	}
+	if strict.ValidateSignature(token, sessionId, "") {
+		t.Errorf("signature was expected to be rejected for an empty secret in strict mode")
+	}
+	jwt := (&JWTCodec{Secret: ""}).Generate(sessionId, now.Add(time.Minute))
+	if (&JWTCodec{Config: strict, Secret: ""}).Validate(jwt, sessionId, now) {
+		t.Errorf("JWT token was expected to be rejected for an empty secret in strict mode")
+	}
+	if strict.Verifier("")([]byte(sessionId), Signer("")([]byte(sessionId))) {
+		t.Errorf("MAC was expected to be rejected for an empty secret in strict mode")
+	}
+	if _, err := strict.GenerateTokenSafe(sessionId, now.Add(time.Minute), ""); !errors.Is(err, ErrEmptySecret) || !errors.Is(err, ErrWeakSecret) {
+		t.Errorf("generation with empty secret was expected to fail with ErrEmptySecret, got: %v", err)
+	}
+	if _, err := NewManager(strict, "", time.Minute); !errors.Is(err, ErrEmptySecret) {
+		t.Errorf("manager with empty secret was expected to fail with ErrEmptySecret, got: %v", err)
+	}
+
+	if !strict.ValidateToken(strict.GenerateToken(sessionId, now.Add(time.Minute), "LoremIpsum123"), sessionId, now, "LoremIpsum123") {
+		t.Errorf("token with a secret was expected to be valid in strict mode")
+	}
+}
+
+func TestTokenConfigTolerance(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	issuedAt := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	expireAt := issuedAt.Add(10 * time.Minute)
+	config := &TokenConfig{IncludeIssuedAt: true, Tolerance: 30 * time.Second, Clock: &FixedClock{Time: issuedAt}}
+	token := config.GenerateToken(sessionId, expireAt, secret)
+
+	for _, tc := range []struct {
+		now   time.Time
+		valid bool
+	}{
+		{issuedAt.Add(-31 * time.Second), false},
+		{issuedAt.Add(-30 * time.Second), true},
+		{expireAt.Add(30 * time.Second), true},
+		{expireAt.Add(31 * time.Second), false},
+	} {
+		if valid := config.ValidateToken(token, sessionId, tc.now, secret); valid != tc.valid {
+			t.Errorf("token at %v was expected to be valid: %v, got: %v", tc.now, tc.valid, valid)
+		}
+	}
+
+	strict := &TokenConfig{IncludeIssuedAt: true}
+	if strict.ValidateToken(token, sessionId, issuedAt.Add(-time.Second), secret) {
+		t.Errorf("token issued in the future was expected to be invalid without tolerance")
+	}
+	if strict.ValidateToken(token, sessionId, expireAt.Add(time.Second), secret) {
+		t.Errorf("expired token was expected to be invalid without tolerance")
+	}
+}
+
+func TestHashInfo(t *testing.T) {
+	if name, size := HashInfo(nil); name != "HMAC-SHA-512/224" || size != 28 {
+		t.Errorf("default hash info was expected to be HMAC-SHA-512/224 of 28 bytes, got: %s of %d bytes", name, size)
+	}
+	if name, size := HashInfo(&TokenConfig{Hash: crypto.SHA256}); name != "HMAC-SHA-256" || size != 32 {
+		t.Errorf("SHA-256 hash info was expected to be HMAC-SHA-256 of 32 bytes, got: %s of %d bytes", name, size)
+	}
+}
+
+func TestSecurityBits(t *testing.T) {
+	if bits := SecurityBits(nil); bits != 224 {
+		t.Errorf("default config was expected to provide 224 bits, got: %d", bits)
+	}
+	if bits := SecurityBits(&TokenConfig{Hash: crypto.SHA256}); bits != 256 {
+		t.Errorf("SHA-256 config was expected to provide 256 bits, got: %d", bits)
+	}
+	if bits := SecurityBits(&TokenConfig{MACMode: BLAKE2Keyed}); bits != 512 {
+		t.Errorf("BLAKE2Keyed config was expected to provide 512 bits, got: %d", bits)
+	}
+}
+
+func TestTokenConfigDebugTimestamps(t *testing.T) {
+	config := &TokenConfig{DebugTimestamps: true}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	token := config.GenerateToken(sessionId, now.Add(time.Hour), secret)
+
+	if !strings.HasSuffix(token, TokenTimestampSeparator+"2021-01-04T13:00:00Z") {
+		t.Errorf("token was expected to carry an RFC 3339 timestamp: %s", token)
+	}
+	parsed, err := config.ParseToken(token)
+	if err != nil || !parsed.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("token was expected to round-trip its expiration date: token=%s, err=%v", token, err)
+	}
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token was expected to be valid: %s", token)
+	}
+	if config.ValidateToken(token, sessionId, now.Add(2*time.Hour), secret) {
+		t.Errorf("token was expected to expire: %s", token)
+	}
+
+	tampered := strings.Replace(token, "13:00:00Z", "14:00:00Z", 1)
+	if config.ValidateToken(tampered, sessionId, now, secret) {
+		t.Errorf("token with an altered timestamp was expected to be invalid: %s", tampered)
+	}
+	for _, noncanonical := range []string{"2021-01-04T13:00:00+00:00", "2021-01-04T13:00:00.0Z"} {
+		if _, err := config.ParseToken(strings.Replace(token, "2021-01-04T13:00:00Z", noncanonical, 1)); !errors.Is(err, ErrBadTimestamp) {
+			t.Errorf("non-canonical timestamp %s was expected to be rejected, got: %v", noncanonical, err)
+		}
+	}
+
+	if ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token with RFC 3339 timestamp was expected to be invalid without DebugTimestamps: %s", token)
+	}
+	if config.ValidateToken(GenerateToken(sessionId, now.Add(time.Hour), secret), sessionId, now, secret) {
+		t.Errorf("token with unix timestamp was expected to be invalid with DebugTimestamps")
+	}
+}
+
+func TestTokenConfigDebugTimestampsWithSeparatorInTimestamp(t *testing.T) {
+	defer func(separator string) {
+		TokenTimestampSeparator = separator
+	}(TokenTimestampSeparator)
+
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	clock := &FixedClock{Time: now}
+
+	for _, separator := range []string{":", "-"} {
+		TokenTimestampSeparator = separator
+		for name, config := range map[string]*TokenConfig{
+			"default":        {Clock: clock, DebugTimestamps: true},
+			"IssuedAt":       {Clock: clock, DebugTimestamps: true, IncludeIssuedAt: true, Versioned: true},
+			"TimestampFirst": {Clock: clock, DebugTimestamps: true, IncludeIssuedAt: true, TimestampFirst: true},
+		} {
+			token := config.GenerateToken(sessionId, now.Add(time.Hour), secret)
+			parsed, err := config.ParseToken(token)
+			if err != nil || parsed.RawTimestamp != "2021-01-04T13:00:00Z" {
+				t.Errorf("%s: token with separator %q was expected to round-trip: token=%s, err=%v", name, separator, token, err)
+			}
+			if !config.ValidateToken(token, sessionId, now, secret) {
+				t.Errorf("%s: token with separator %q was expected to be valid: %s", name, separator, token)
+			}
+		}
+	}
+}
+
+func TestTokenConfigCaseInsensitiveHex(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	config := &TokenConfig{CaseInsensitiveHex: true}
+	token := config.GenerateToken(sessionId, now.Add(time.Minute), secret)
+	upper := strings.ToUpper(token)
+	if upper == token {
+		t.Fatalf("token was expected to contain letters: %s", token)
+	}
+
+	if !config.ValidateToken(upper, sessionId, now, secret) {
+		t.Errorf("uppercased token was expected to be valid with CaseInsensitiveHex: %s", upper)
+	}
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("lowercase token was expected to be valid with CaseInsensitiveHex: %s", token)
+	}
+	if config.ValidateToken(upper, "user2-login", now, secret) {
+		t.Errorf("uppercased token was expected to be invalid for another session")
+	}
+	if ValidateToken(upper, sessionId, now, secret) {
+		t.Errorf("uppercased token was expected to be invalid without CaseInsensitiveHex: %s", upper)
+	}
+}
+
+func TestTokenConfigPadTimestamps(t *testing.T) {
+	config := &TokenConfig{PadTimestamps: true, IncludeIssuedAt: true}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	length := config.TokenLength()
+	for _, expireAt := range []time.Time{now.Add(time.Minute), time.Unix(5, 0), time.Unix(maxDecimalTimestamp/1000, 0)} {
+		token := config.GenerateToken(sessionId, expireAt, secret)
+		if len(token) != length {
+			t.Errorf("token was expected to be %d bytes long, got %d: %s", length, len(token), token)
+		}
+
+		parsed, err := config.ParseToken(token)
+		if err != nil || !parsed.ExpiresAt.Equal(time.Unix(expireAt.Unix(), 0)) {
+			t.Errorf("token was expected to round-trip its expiration date: token=%s, err=%v", token, err)
+		}
+		if !config.ValidateSignature(token, sessionId, secret) {
+			t.Errorf("token signature was expected to be valid: %s", token)
+		}
+	}
+
+	token := config.GenerateToken(sessionId, now.Add(time.Minute), secret)
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token was expected to be valid: %s", token)
+	}
+	if (&TokenConfig{IncludeIssuedAt: true}).ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("padded token was expected to be invalid without PadTimestamps: %s", token)
+	}
+	unpadded := (&TokenConfig{IncludeIssuedAt: true}).GenerateToken(sessionId, now.Add(time.Minute), secret)
+	if config.ValidateToken(unpadded, sessionId, now, secret) {
+		t.Errorf("unpadded token was expected to be invalid with PadTimestamps: %s", unpadded)
+	}
+}
+
+func TestOversizedTokensAreRejectedBeforeHMAC(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	var computed int
+	testHookHMAC = func() { computed++ }
+	defer func() { testHookHMAC = nil }()
+
+	config := &TokenConfig{MaxTokenLength: 80}
+	token := config.GenerateToken(sessionId, now.Add(time.Minute), secret)
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token within the limit was expected to be valid: %s", token)
+	}
+
+	computed = 0
+	oversized := strings.Repeat("a", 81)
+	if _, err := config.ParseToken(oversized); !errors.Is(err, ErrTokenTooLong) || !errors.Is(err, ErrMalformedToken) {
+		t.Errorf("ErrTokenTooLong was expected, got: %v", err)
+	}
+	if config.ValidateToken(oversized, sessionId, now, secret) {
+		t.Errorf("oversized token was expected to be invalid")
+	}
+	if ValidateToken(token+strings.Repeat("0", 1<<20), sessionId, now, secret) {
+		t.Errorf("oversized token was expected to be invalid with the default limit")
+	}
+	if computed != 0 {
+		t.Errorf("HMAC of oversized tokens was not expected to be computed, computed: %d", computed)
+	}
+
+	unlimited := &TokenConfig{MaxTokenLength: -1}
+	if _, err := unlimited.ParseToken(token + strings.Repeat("0", 1<<10)); errors.Is(err, ErrTokenTooLong) {
+		t.Errorf("negative limit was expected to disable the check, got: %v", err)
+	}
+}
+
+func TestTokenConfigTimestampFirst(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(time.Minute)
+
+	for _, config := range []*TokenConfig{
+		{TimestampFirst: true},
+		{TimestampFirst: true, IncludeIssuedAt: true, Versioned: true},
+		{TimestampFirst: true, FixedWidth: true, IncludeIssuedAt: true},
+	} {
+		token := config.GenerateToken(sessionId, expireAt, secret)
+		if !config.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("timestamp-first token was expected to be valid: %s", token)
+		}
+
+		parsed, err := config.ParseToken(token)
+		if err != nil || !parsed.ExpiresAt.Equal(time.Unix(expireAt.Unix(), 0)) || !strings.HasSuffix(token, parsed.Hash) {
+			t.Errorf("timestamp-first token was expected to round-trip: token=%s, parsed=%+v, err=%v", token, parsed, err)
+		}
+
+		if data, err := config.MarshalBinary(token); err != nil {
+			t.Errorf("timestamp-first token was expected to be packed: %v", err)
+		} else if unpacked, err := config.UnmarshalBinary(data); err != nil || unpacked != token {
+			t.Errorf("timestamp-first token was expected to be unpacked: token=%s, unpacked=%s, err=%v", token, unpacked, err)
+		}
+
+		hashFirst := &TokenConfig{IncludeIssuedAt: config.IncludeIssuedAt, Versioned: config.Versioned, FixedWidth: config.FixedWidth}
+		if hashFirst.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("timestamp-first token was expected to be invalid for a hash-first config: %s", token)
+		}
+		if config.ValidateToken(hashFirst.GenerateToken(sessionId, expireAt, secret), sessionId, now, secret) {
+			t.Errorf("hash-first token was expected to be invalid for a timestamp-first config")
+		}
+	}
+
+	token := (&TokenConfig{TimestampFirst: true}).GenerateToken(sessionId, expireAt, secret)
+	if !strings.HasPrefix(token, strconv.FormatInt(expireAt.Unix(), 10)+TokenTimestampSeparator) {
+		t.Errorf("token was expected to start with the timestamp: %s", token)
+	}
+}
+
+func TestConstantTimeRejectComputesHMACOfMalformedTokens(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	var computed int
+	testHookHMAC = func() { computed++ }
+	defer func() { testHookHMAC = nil }()
+
+	token := GenerateToken(sessionId, now.Add(time.Minute), secret)
+	malformed := []string{"", "lorem", token + "x", strings.Replace(token, ".", ".x", 1), "v9." + token, strings.Repeat("a", 200)}
+
+	config := &TokenConfig{Versioned: true, ConstantTimeReject: true}
+	for _, token := range malformed {
+		computed = 0
+		if config.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("malformed token was expected to be invalid: %s", token)
+		}
+		if computed != 1 {
+			t.Errorf("HMAC of malformed token was expected to be computed once, computed: %d, token: %s", computed, token)
+		}
+	}
+
+	computed = 0
+	for _, token := range malformed {
+		(&TokenConfig{Versioned: true}).ValidateToken(token, sessionId, now, secret)
+	}
+	if computed != 0 {
+		t.Errorf("HMAC of malformed tokens was not expected to be computed by default, computed: %d", computed)
+	}
+
+	if !config.ValidateToken(config.GenerateToken(sessionId, now.Add(time.Minute), secret), sessionId, now, secret) {
+		t.Errorf("well-formed token was expected to be valid")
+	}
+}
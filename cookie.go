@@ -0,0 +1,90 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrInsecureSameSiteNone is returned by SetTokenCookie for SameSite=None cookies without Secure,
+// which browsers reject.
+var ErrInsecureSameSiteNone = errors.New("csrf: SameSite=None cookie must be Secure")
+
+// CookieOptions configures the cookie the token is stored in.
+type CookieOptions struct {
+	// Name of the cookie, "csrf_token" by default.
+	Name string
+	// Path of the cookie, "/" by default.
+	Path     string
+	Domain   string
+	Secure   bool
+	HttpOnly bool
+	// SameSite mode of the cookie, http.SameSiteLaxMode by default.
+	// http.SameSiteNoneMode (e.g. for embedded third-party contexts) requires Secure.
+	SameSite http.SameSite
+}
+
+// SetTokenCookie sets the cookie with the token, expiring together with the token.
+func SetTokenCookie(w http.ResponseWriter, token string, expireAt time.Time, opts CookieOptions) error {
+	if opts.SameSite == http.SameSiteNoneMode && !opts.Secure {
+		return ErrInsecureSameSiteNone
+	}
+	if opts.Name == "" {
+		opts.Name = "csrf_token"
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     opts.Name,
+		Value:    token,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		Expires:  expireAt,
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	})
+
+	return nil
+}
+
+// CookieMaxAge returns the number of seconds until the token expires, for http.Cookie.MaxAge, so the cookie expires
+// together with the token. See TokenConfig.CookieMaxAge for details.
+func CookieMaxAge(token string, now time.Time) int {
+	return defaultConfig.CookieMaxAge(token, now)
+}
+
+// CookieMaxAge returns the number of whole seconds until the token expires, for http.Cookie.MaxAge.
+// It is never negative: 0 is returned for expired tokens and tokens that can't be parsed.
+func (c *TokenConfig) CookieMaxAge(token string, now time.Time) int {
+	parsed, err := c.ParseToken(token)
+	if err != nil {
+		return 0
+	}
+
+	return int(max(0, parsed.ExpiresAt.Sub(now)/time.Second))
+}
@@ -0,0 +1,91 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetTokenCookieDefaultsToLax(t *testing.T) {
+	w := httptest.NewRecorder()
+	expireAt := time.Now().Add(time.Hour)
+
+	if err := SetTokenCookie(w, "loremipsum.1609787986", expireAt, CookieOptions{}); err != nil {
+		t.Fatalf("setting the cookie failed: %s", err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("one cookie was expected, got: %v", cookies)
+	}
+	cookie := cookies[0]
+	if cookie.Name != "csrf_token" || cookie.Value != "loremipsum.1609787986" || cookie.Path != "/" {
+		t.Errorf("unexpected cookie: %v", cookie)
+	}
+	if cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie was expected to be SameSite=Lax, got: %v", cookie.SameSite)
+	}
+}
+
+func TestSetTokenCookieRejectsInsecureSameSiteNone(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	err := SetTokenCookie(w, "loremipsum.1609787986", time.Now().Add(time.Hour), CookieOptions{SameSite: http.SameSiteNoneMode})
+
+	if err != ErrInsecureSameSiteNone {
+		t.Errorf("ErrInsecureSameSiteNone was expected, got: %v", err)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("cookie was not expected to be written")
+	}
+}
+
+func TestSetTokenCookieAcceptsSecureSameSiteNone(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	err := SetTokenCookie(w, "loremipsum.1609787986", time.Now().Add(time.Hour), CookieOptions{SameSite: http.SameSiteNoneMode, Secure: true})
+
+	if err != nil {
+		t.Errorf("setting the cookie failed: %s", err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].SameSite != http.SameSiteNoneMode || !cookies[0].Secure {
+		t.Errorf("secure SameSite=None cookie was expected, got: %v", cookies)
+	}
+}
+
+func TestCookieMaxAge(t *testing.T) {
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	if maxAge := CookieMaxAge(GenerateToken("user1-login", now.Add(time.Hour), "LoremIpsum123"), now); maxAge != 3600 {
+		t.Errorf("max age was expected to be 3600, got: %d", maxAge)
+	}
+	if maxAge := CookieMaxAge(GenerateToken("user1-login", now.Add(time.Hour), "LoremIpsum123"), now.Add(500*time.Millisecond)); maxAge != 3599 {
+		t.Errorf("max age was expected to be rounded down to 3599, got: %d", maxAge)
+	}
+	if maxAge := CookieMaxAge(GenerateToken("user1-login", now.Add(-time.Hour), "LoremIpsum123"), now); maxAge != 0 {
+		t.Errorf("max age of an expired token was expected to be 0, got: %d", maxAge)
+	}
+	if maxAge := CookieMaxAge("malformed", now); maxAge != 0 {
+		t.Errorf("max age of a malformed token was expected to be 0, got: %d", maxAge)
+	}
+}
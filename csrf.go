@@ -21,73 +21,296 @@
 package csrf
 
 import (
-	"crypto/hmac"
-	"crypto/sha512"
+	"crypto"
+	"crypto/sha256"
+	_ "crypto/sha512" // registers crypto.SHA512_224, the default hash
 	"crypto/subtle"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"strconv"
-	"strings"
 	"time"
 )
 
 var (
+	// TokenTimestampSeparator separates the token segments. Tokens are split only at it, so the tokens generated
+	// with another separator are rejected as malformed. It may be several characters long, e.g. "--".
 	TokenTimestampSeparator = "."
 )
 
+var defaultConfig = &TokenConfig{}
+
+var (
+	// ErrMalformedToken is returned when the token does not have the expected format.
+	ErrMalformedToken = errors.New("csrf: malformed token")
+	// ErrWrongSegments is returned when the token does not have the expected segments, it matches ErrMalformedToken.
+	ErrWrongSegments = fmt.Errorf("%w: wrong number of segments", ErrMalformedToken)
+	// ErrBadTimestamp is returned when a timestamp in the token is not numeric, it matches ErrMalformedToken.
+	ErrBadTimestamp = fmt.Errorf("%w: bad timestamp", ErrMalformedToken)
+	// ErrTokenTooLong is returned when the token is longer than TokenConfig.MaxTokenLength, it matches ErrMalformedToken.
+	ErrTokenTooLong = fmt.Errorf("%w: token too long", ErrMalformedToken)
+	// ErrUnsupportedVersion is returned when the token has an unknown format version.
+	ErrUnsupportedVersion = errors.New("csrf: unsupported token version")
+	// ErrWeakSecret is returned when the secret is shorter than TokenConfig.MinSecretLength.
+	ErrWeakSecret = errors.New("csrf: secret is too short")
+	// ErrEmptySecret is returned for an empty secret when TokenConfig.StrictSecret is set, it matches ErrWeakSecret.
+	ErrEmptySecret = fmt.Errorf("%w: empty secret", ErrWeakSecret)
+	// ErrZeroExpiry is returned by GenerateTokenSafe for the zero expiration date, which is almost always a bug.
+	ErrZeroExpiry = errors.New("csrf: zero expiration date")
+	// ErrLengthMismatch is returned by ValidateTokens when the tokens and the sessionIds have different lengths.
+	ErrLengthMismatch = errors.New("csrf: tokens and sessionIds have different lengths")
+)
+
+// DefaultMinSecretLength is the recommended value of TokenConfig.MinSecretLength.
+const DefaultMinSecretLength = 32
+
+// ParsedToken is a structured view of the token segments.
+type ParsedToken struct {
+	// Version is the format version of the token, empty for tokens without the version.
+	Version string
+	// Hash is the HMAC segment of the token.
+	Hash string
+	// ExpiresAt is the expiration date embedded in the token.
+	ExpiresAt time.Time
+	// RawTimestamp is the expiration date segment as found in the token.
+	RawTimestamp string
+	// IssuedAt is the issuance time embedded in the token, zero unless TokenConfig.IncludeIssuedAt is set.
+	IssuedAt time.Time
+
+	rawIssuedAt string
+}
+
 // GenerateToken generates HMAC Based CSRF Token.
 // sessionId should be unique for every user and operation, e.g. sha256(userId + operationName), but it depends on the use-case.
+// It may contain arbitrary bytes, including binary data and the separators used in the token.
 // expireAt is the date when the token expires, ideally this should be not too far in the future - an hour or 2 should be just right.
 // secret is what makes the tokens secure - it is known only to the server, so only the server can generate tokens.
+// The token is deterministic - the same arguments always produce the same token, which is also the canonical form
+// of masked tokens (see GenerateMaskedToken), so it can be relied on when re-rendering or caching a page.
 func GenerateToken(sessionId string, expireAt time.Time, secret string) string {
+	return generateDefault(sessionId, expireAt, secret)
+}
+
+// WriteToken writes the token GenerateToken generates for the same arguments to w, without allocating the token string.
+func WriteToken(w io.Writer, sessionId string, expireAt time.Time, secret string) (int, error) {
+	return defaultConfig.WriteToken(w, sessionId, expireAt, secret)
+}
+
+// GenerateTokenTTL2 generates a token that expires after ttl and returns it together with its expiration date,
+// e.g. to set the cookie expiry. The expiration date is truncated to seconds, exactly as embedded in the token.
+func GenerateTokenTTL2(sessionId string, ttl time.Duration, secret string) (string, time.Time) {
+	expireAt := time.Unix(defaultConfig.now().Add(ttl).Unix(), 0)
+
+	return GenerateToken(sessionId, expireAt, secret), expireAt
+}
+
+// GenerateTokens generates tokens for every sessionId, in the same order, like GenerateToken.
+// The HMAC state is prepared once for the whole batch, which is faster than separate calls.
+func GenerateTokens(sessionIds []string, expireAt time.Time, secret string) []string {
+	h := defaultConfig.hash()
+	m := getMac(h)
+	defer putMac(h, m)
+
 	ts := strconv.FormatInt(expireAt.Unix(), 10)
-	contents := tokenContents(sessionId, ts)
+	m.setKey(secret)
 
-	var tsb strings.Builder
-	tsb.WriteString(hmacToken(contents, secret))
-	tsb.WriteString(TokenTimestampSeparator)
-	tsb.WriteString(ts)
+	tokens := make([]string, len(sessionIds))
+	for i, sessionId := range sessionIds {
+		m.buf = appendTokenContents(m.buf[:0], sessionId, ts)
+		tokens[i] = string(m.keyedHexSum()) + TokenTimestampSeparator + ts
+	}
 
-	return tsb.String()
+	return tokens
 }
 
 // ValidateToken checks if the HMAC Based CSRF Token is valid for the session and has not expired.
 // Token is compared using subtle.ConstantTimeCompare to mitigate timing attacks.
 func ValidateToken(token, sessionId string, now time.Time, secret string) bool {
-	parts := strings.Split(token, TokenTimestampSeparator)
-	if len(parts) != 2 {
-		return false
-	}
-	hash := parts[0]
-	expireAt := parts[1]
+	return validateDefault(token, sessionId, now, secret)
+}
+
+// Diagnose returns every reason why the token is invalid, for debugging only. See TokenConfig.Diagnose for details.
+func Diagnose(token, sessionId string, now time.Time, secret string) []string {
+	return defaultConfig.Diagnose(token, sessionId, now, secret)
+}
+
+// ValidateAndParse works like ValidateToken, but also returns the parsed token when it is valid, nil otherwise.
+func ValidateAndParse(token, sessionId string, now time.Time, secret string) (*ParsedToken, bool) {
+	return defaultConfig.ValidateAndParse(token, sessionId, now, secret)
+}
+
+// ValidateTokenBytesToken works exactly like ValidateToken for a token held in a byte slice, without copying it.
+// See TokenConfig.ValidateTokenBytesToken for details.
+func ValidateTokenBytesToken(token []byte, sessionId string, now time.Time, secret string) bool {
+	return defaultConfig.ValidateTokenBytesToken(token, sessionId, now, secret)
+}
+
+// ValidateTokens validates every token for the sessionId at the same index and returns the results in the same order.
+// See TokenConfig.ValidateTokens for details.
+func ValidateTokens(tokens, sessionIds []string, now time.Time, secret string) ([]bool, error) {
+	return defaultConfig.ValidateTokens(tokens, sessionIds, now, secret)
+}
 
-	expireAtInt, err := strconv.ParseInt(expireAt, 10, 64)
+// ValidateSignature checks only that the token is well-formed and its HMAC is valid, ignoring its expiration date.
+// See TokenConfig.ValidateSignature for details.
+func ValidateSignature(token, sessionId string, secret string) bool {
+	return defaultConfig.ValidateSignature(token, sessionId, secret)
+}
+
+// ValidateTokenFunc works like ValidateToken, but resolves the secret with secretFn only for well-formed tokens.
+// See TokenConfig.ValidateTokenFunc for details.
+func ValidateTokenFunc(token, sessionId string, now time.Time, secretFn func(sessionId string) (string, error)) bool {
+	return defaultConfig.ValidateTokenFunc(token, sessionId, now, secretFn)
+}
+
+// ValidateTokenWithRevocation works like ValidateToken, but also rejects the token when its sessionId is revoked.
+// See TokenConfig.ValidateTokenWithRevocation for details.
+func ValidateTokenWithRevocation(token, sessionId string, now time.Time, secret string, revoked func(sessionId string) bool) bool {
+	return defaultConfig.ValidateTokenWithRevocation(token, sessionId, now, secret, revoked)
+}
+
+// ValidateWithRemaining works like ValidateToken, but also returns how long the token remains valid.
+// See TokenConfig.ValidateWithRemaining for details.
+func ValidateWithRemaining(token, sessionId string, now time.Time, secret string) (bool, time.Duration) {
+	return defaultConfig.ValidateWithRemaining(token, sessionId, now, secret)
+}
+
+// Resign re-issues the token valid under oldSecret, signed with newSecret, with the same expiration date.
+// See TokenConfig.Resign for details.
+func Resign(token, sessionId string, now time.Time, oldSecret, newSecret string) (string, bool) {
+	return defaultConfig.Resign(token, sessionId, now, oldSecret, newSecret)
+}
+
+// TokenMAC returns the raw HMAC of the token GenerateToken generates for the same arguments, e.g. to embed it in
+// another signed envelope. The hash segment of the token is its hex encoding.
+func TokenMAC(sessionId string, expireAt time.Time, secret string) []byte {
+	return defaultConfig.TokenMAC(sessionId, expireAt, secret)
+}
+
+// ParseToken splits the token generated by GenerateToken into its segments without validating it.
+func ParseToken(token string) (*ParsedToken, error) {
+	return defaultConfig.ParseToken(token)
+}
+
+// TokenExpiry returns the expiration date embedded in the token generated by GenerateToken, without validating it.
+func TokenExpiry(token string) (time.Time, error) {
+	parsed, err := ParseToken(token)
 	if err != nil {
-		return false
+		return time.Time{}, err
 	}
-	// expiration is in the past (before now)
-	if time.Unix(expireAtInt, 0).Before(now) {
-		return false
+
+	return parsed.ExpiresAt, nil
+}
+
+// TokenLength returns the maximum length of tokens generated by GenerateToken, e.g. to size a database column.
+// See TokenConfig.TokenLength for details.
+func TokenLength() int {
+	return defaultConfig.TokenLength()
+}
+
+// HashInfo returns the name of the MAC algorithm used by the config (nil for the default one) and the size of the MAC
+// in bytes. See TokenConfig.HashInfo for details.
+func HashInfo(config *TokenConfig) (name string, outputBytes int) {
+	if config == nil {
+		config = defaultConfig
 	}
 
-	hashSample := hmacToken(tokenContents(sessionId, expireAt), secret)
+	return config.HashInfo()
+}
 
-	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashSample)) == 1
+// SecurityBits returns the forgery resistance in bits of the tokens of the config (nil for the default one).
+// See TokenConfig.SecurityBits for details.
+func SecurityBits(config *TokenConfig) int {
+	if config == nil {
+		config = defaultConfig
+	}
+
+	return config.SecurityBits()
 }
 
-func tokenContents(sessionId, expireAtUnix string) string {
-	var csb strings.Builder
+// ValidateTokenForAny checks the token against every sessionId and returns the one it is valid for.
+// Every sessionId is checked, like every secret in Manager.Validate.
+func ValidateTokenForAny(token string, sessionIds []string, now time.Time, secret string) (string, bool) {
+	match := -1
+	for i, sessionId := range sessionIds {
+		valid := 0
+		if ValidateToken(token, sessionId, now, secret) {
+			valid = 1
+		}
+		match = subtle.ConstantTimeSelect(valid, i, match)
+	}
 
-	csb.WriteString(sessionId)
-	csb.WriteString("|")
-	csb.WriteString(expireAtUnix)
+	if match < 0 {
+		return "", false
+	}
 
-	return csb.String()
+	return sessionIds[match], true
 }
 
-func hmacToken(contents, secret string) string {
-	hash := hmac.New(sha512.New512_224, []byte(secret))
-	hash.Write([]byte(contents))
-	sum := hash.Sum(nil)
+// TokensEqual compares two tokens, e.g. the cookie and the form value in the double-submit pattern, in constant time.
+// Tokens of different lengths are padded to the same length before comparison, so the comparison does not exit early.
+func TokensEqual(a, b string) bool {
+	size := len(a)
+	if len(b) > size {
+		size = len(b)
+	}
+
+	paddedA := make([]byte, size)
+	paddedB := make([]byte, size)
+	copy(paddedA, a)
+	copy(paddedB, b)
+
+	equal := subtle.ConstantTimeCompare(paddedA, paddedB)
+	sameLength := subtle.ConstantTimeEq(int32(len(a)), int32(len(b)))
+
+	return equal&sameLength == 1
+}
+
+// TokenFingerprint returns a short, non-reversible fingerprint of the token (the first 8 hex characters of its SHA-256),
+// safe to log to correlate repeated attempts. It works on any string, including malformed tokens.
+func TokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:4])
+}
+
+// tokenContents builds the HMAC input: "sessionId|timestamp[|timestamp]".
+// Timestamps are decimal numbers, so everything before the first of the trailing "|timestamp" fields is the sessionId,
+// even if it contains "|" itself - different sessionId/timestamp pairs never produce the same contents.
+func tokenContents(sessionId string, timestamps ...string) string {
+	return string(appendTokenContents(nil, sessionId, timestamps...))
+}
+
+func appendTokenContents(dst []byte, sessionId string, timestamps ...string) []byte {
+	dst = append(dst, sessionId...)
+	for _, ts := range timestamps {
+		dst = append(dst, '|')
+		dst = append(dst, ts...)
+	}
+
+	return dst
+}
+
+// appendFramedContents builds the HMAC input of TokenConfig.FramedContents tokens:
+// every field is prefixed with its length as uvarint, so the fields can't be re-split whatever bytes they contain.
+func appendFramedContents(dst []byte, sessionId string, timestamps ...string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(sessionId)))
+	dst = append(dst, sessionId...)
+	for _, ts := range timestamps {
+		dst = binary.AppendUvarint(dst, uint64(len(ts)))
+		dst = append(dst, ts...)
+	}
+
+	return dst
+}
+
+func hmacToken(h crypto.Hash, contents, secret string) string {
+	m := getMac(h)
+	defer putMac(h, m)
+
+	m.buf = append(m.buf[:0], contents...)
 
-	return hex.EncodeToString(sum)
+	return string(m.hexSum(secret))
 }
@@ -20,10 +20,16 @@
 package csrf
 
 import (
+	"bytes"
+	"crypto"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -152,3 +158,847 @@ func TestTokenWithOnePartIsInvalid(t *testing.T) {
 		t.Errorf("token validation was expected to fail, but passed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, now)
 	}
 }
+
+func TestValidateTokenForAnyReturnsMatchedSessionId(t *testing.T) {
+	sessionIds := []string{"user1-login", "user1-logout", "user1-delete"}
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := GenerateToken("user1-logout", expireAt, secret)
+
+	matched, ok := ValidateTokenForAny(token, sessionIds, now, secret)
+
+	if !ok || matched != "user1-logout" {
+		t.Errorf("token was expected to match user1-logout: token=%s, matched=%s, ok=%t", token, matched, ok)
+	}
+}
+
+func TestValidateTokenForAnyWithoutMatchIsInvalid(t *testing.T) {
+	sessionIds := []string{"user1-login", "user1-logout"}
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := GenerateToken("user2-login", expireAt, secret)
+
+	if matched, ok := ValidateTokenForAny(token, sessionIds, now, secret); ok {
+		t.Errorf("token validation was expected to fail, but matched: token=%s, matched=%s", token, matched)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	expireAt := time.Unix(1609787986, 0)
+
+	token := GenerateToken(sessionId, expireAt, secret)
+
+	parsed, err := ParseToken(token)
+	if err != nil {
+		t.Fatalf("token parsing failed: token=%s, err=%s", token, err)
+	}
+
+	if parsed.Hash != hmacToken(crypto.SHA512_224, tokenContents(sessionId, "1609787986"), secret) {
+		t.Errorf("unexpected hash: %s", parsed.Hash)
+	}
+	if !parsed.ExpiresAt.Equal(expireAt) {
+		t.Errorf("unexpected expiration date: %s", parsed.ExpiresAt)
+	}
+	if parsed.RawTimestamp != "1609787986" {
+		t.Errorf("unexpected raw timestamp: %s", parsed.RawTimestamp)
+	}
+}
+
+func TestParseTokenRejectsMalformedTokens(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now(), "LoremIpsum123")
+
+	for _, malformed := range []string{
+		strings.Split(token, TokenTimestampSeparator)[0],
+		token + ".loremipsum",
+		replaceTimestampInToken(token, "loremipsum"),
+	} {
+		if _, err := ParseToken(malformed); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("token parsing was expected to fail with ErrMalformedToken: token=%s, err=%v", malformed, err)
+		}
+	}
+}
+
+func TestTokensEqual(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(5*time.Minute), "LoremIpsum123")
+	otherToken := GenerateToken("user2-login", time.Now().Add(5*time.Minute), "LoremIpsum123")
+
+	if !TokensEqual(token, token) {
+		t.Errorf("tokens were expected to be equal: token=%s", token)
+	}
+
+	if TokensEqual(token, otherToken) {
+		t.Errorf("tokens of the same length were expected to differ: a=%s, b=%s", token, otherToken)
+	}
+
+	if TokensEqual(token, token+"0") || TokensEqual(token+"0", token) {
+		t.Errorf("tokens of different lengths were expected to differ: token=%s", token)
+	}
+
+	if TokensEqual(token, token+"\x00") {
+		t.Errorf("token padded with zero byte was expected to differ: token=%s", token)
+	}
+}
+
+func TestTokenWithEmptySegmentsIsInvalid(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := GenerateToken(sessionId, expireAt, secret)
+	parts := strings.Split(token, TokenTimestampSeparator)
+
+	for _, malformed := range []string{
+		TokenTimestampSeparator + parts[1],
+		parts[0] + TokenTimestampSeparator,
+		TokenTimestampSeparator,
+	} {
+		if ValidateToken(malformed, sessionId, now, secret) {
+			t.Errorf("token validation was expected to fail, but passed: token=%s", malformed)
+		}
+
+		if _, err := ParseToken(malformed); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("token parsing was expected to fail with ErrMalformedToken: token=%s, err=%v", malformed, err)
+		}
+
+		if _, reason := defaultConfig.validate(nil, malformed, sessionId, now, secret); reason != ReasonMalformed {
+			t.Errorf("token was expected to be rejected as malformed: token=%s, reason=%s", malformed, reason)
+		}
+	}
+}
+
+func TestTokenWithBinarySessionId(t *testing.T) {
+	// 16-byte UUID containing "|" and "." bytes
+	sessionId := string([]byte{0x7c, 0x2e, 0x00, 0xff, 0x31, 0x7c, 0x32, 0x2e, 0x7c, 0x33, 0x80, 0x01, 0x2e, 0x2e, 0x7c, 0x7c})
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token := GenerateToken(sessionId, expireAt, secret)
+
+	if !ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token validation failed: token=%s, sessionId=%x, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, now)
+	}
+
+	// digits moved between the sessionId and the timestamp
+	if tokenContents("user|1", "23") == tokenContents("user", "123") || tokenContents("user1", "23") == tokenContents("user", "123") {
+		t.Errorf("contents of different sessionId/timestamp pairs were expected to differ")
+	}
+
+	ts := strconv.FormatInt(expireAt.Unix(), 10)
+	shiftedToken := GenerateToken("user|"+ts, expireAt, secret)
+
+	if ValidateToken(shiftedToken, "user", now, secret) || ValidateToken(shiftedToken, "user|", now, secret) {
+		t.Errorf("token validation was expected to fail for a different split of the sessionId, but passed: token=%s", shiftedToken)
+	}
+}
+
+func TestFramedContentsNeverCollide(t *testing.T) {
+	// moving any number of bytes between the sessionId and the timestamp must change the contents
+	resplit := func(sessionId, ts string, cut uint8) bool {
+		joined := sessionId + ts
+		at := int(cut) % (len(joined) + 1)
+		other := string(appendFramedContents(nil, joined[:at], joined[at:]))
+
+		return (other == string(appendFramedContents(nil, sessionId, ts))) == (at == len(sessionId))
+	}
+	if err := quick.Check(resplit, nil); err != nil {
+		t.Error(err)
+	}
+
+	distinct := func(sessionId1, ts1, sessionId2, ts2 string) bool {
+		equal := string(appendFramedContents(nil, sessionId1, ts1)) == string(appendFramedContents(nil, sessionId2, ts2))
+
+		return equal == (sessionId1 == sessionId2 && ts1 == ts2)
+	}
+	if err := quick.Check(distinct, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTokenConfigFramedContents(t *testing.T) {
+	sessionId := "user|1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	framed := &TokenConfig{FramedContents: true, IncludeIssuedAt: true}
+
+	token := framed.GenerateToken(sessionId, now.Add(time.Minute), secret)
+	if !framed.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("framed token was expected to be valid: %s", token)
+	}
+	unframed := &TokenConfig{IncludeIssuedAt: true}
+	if unframed.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("framed token was expected to be rejected by config without FramedContents")
+	}
+	if framed.ValidateToken(unframed.GenerateToken(sessionId, now.Add(time.Minute), secret), sessionId, now, secret) {
+		t.Errorf("unframed token was expected to be rejected by config with FramedContents")
+	}
+}
+
+func TestGenerateTokenTTL2ReturnsEmbeddedExpiry(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+
+	token, expiresAt := GenerateTokenTTL2(sessionId, 5*time.Minute, secret)
+
+	embedded, err := TokenExpiry(token)
+	if err != nil {
+		t.Fatalf("reading token expiry failed: token=%s, err=%s", token, err)
+	}
+
+	if expiresAt != embedded {
+		t.Errorf("returned expiry does not match the embedded one: returned=%s, embedded=%s", expiresAt, embedded)
+	}
+
+	if !ValidateToken(token, sessionId, expiresAt, secret) || ValidateToken(token, sessionId, expiresAt.Add(time.Second), secret) {
+		t.Errorf("token was expected to be valid until exactly the returned expiry: token=%s, expiresAt=%s", token, expiresAt)
+	}
+}
+
+func TestTokensAreNotAcceptedAcrossSeparators(t *testing.T) {
+	defer func(separator string) {
+		TokenTimestampSeparator = separator
+	}(TokenTimestampSeparator)
+
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	for _, config := range []*TokenConfig{{}, {IncludeIssuedAt: true}, {Versioned: true}} {
+		TokenTimestampSeparator = "."
+		dotted := config.GenerateToken(sessionId, expireAt, secret)
+		TokenTimestampSeparator = ":"
+		colon := config.GenerateToken(sessionId, expireAt, secret)
+
+		if !config.ValidateToken(colon, sessionId, now, secret) {
+			t.Errorf("token was expected to be valid with its own separator: token=%s", colon)
+		}
+		if _, err := config.ParseToken(dotted); !errors.Is(err, ErrMalformedToken) && !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("token with another separator was expected to be rejected: token=%s, err=%v", dotted, err)
+		}
+		if config.ValidateToken(dotted, sessionId, now, secret) {
+			t.Errorf("token with another separator was expected to be invalid: token=%s", dotted)
+		}
+
+		TokenTimestampSeparator = "."
+		if config.ValidateToken(colon, sessionId, now, secret) {
+			t.Errorf("token with another separator was expected to be invalid: token=%s", colon)
+		}
+	}
+
+	// a mixed token splits at the configured separator, leaving the other one in the hash
+	TokenTimestampSeparator = ":"
+	mixed := strings.Replace(GenerateToken(sessionId, expireAt, secret), ":", ".", 1) + ":" + strconv.FormatInt(expireAt.Unix(), 10)
+	if _, err := ParseToken(mixed); !errors.Is(err, ErrWrongSegments) {
+		t.Errorf("mixed token was expected to fail with ErrWrongSegments: token=%s, err=%v", mixed, err)
+	}
+}
+
+func TestTokenWithSeparatorInHash(t *testing.T) {
+	defer func(separator string) {
+		TokenTimestampSeparator = separator
+	}(TokenTimestampSeparator)
+	// hex encoded hashes are likely to contain "a"
+	TokenTimestampSeparator = "a"
+
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	separatorInHash := false
+	for _, sessionId := range []string{"user1-login", "user2-login", "user3-login"} {
+		token := GenerateToken(sessionId, expireAt, secret)
+
+		parsed, err := ParseToken(token)
+		if err != nil {
+			t.Errorf("token parsing failed: token=%s, err=%s", token, err)
+			continue
+		}
+		separatorInHash = separatorInHash || strings.Contains(parsed.Hash, TokenTimestampSeparator)
+		if parsed.RawTimestamp != strconv.FormatInt(expireAt.Unix(), 10) {
+			t.Errorf("timestamp was expected to be isolated by the last separator: token=%s, timestamp=%s", token, parsed.RawTimestamp)
+		}
+
+		if !ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("token validation failed: token=%s, sessionId=%s", token, sessionId)
+		}
+	}
+
+	if !separatorInHash {
+		t.Errorf("at least one hash was expected to contain the separator")
+	}
+
+	if ValidateToken("a"+strconv.FormatInt(expireAt.Unix(), 10), "user1-login", now, secret) {
+		t.Errorf("token with an empty hash was expected to be invalid")
+	}
+}
+
+func TestTokenWithMultiCharacterSeparator(t *testing.T) {
+	defer func(separator string) {
+		TokenTimestampSeparator = separator
+	}(TokenTimestampSeparator)
+	// base64url encoded opaque timestamps may contain "--" too
+	TokenTimestampSeparator = "--"
+
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	clock := &FixedClock{Time: now}
+
+	opaque := &TokenConfig{OpaqueTimestamp: true}
+	expireAt := now.Add(5 * time.Minute)
+	for !strings.Contains(opaque.formatTimestamp(expireAt), TokenTimestampSeparator) {
+		expireAt = expireAt.Add(time.Second)
+	}
+
+	for name, config := range map[string]*TokenConfig{
+		"default":         {Clock: clock},
+		"IncludeIssuedAt": {Clock: clock, IncludeIssuedAt: true},
+		"Versioned":       {Clock: clock, Versioned: true},
+		"Opaque":          {Clock: clock, OpaqueTimestamp: true},
+		"OpaqueIssuedAt":  {Clock: clock, OpaqueTimestamp: true, IncludeIssuedAt: true, Versioned: true},
+		"OpaqueFirst":     {Clock: clock, OpaqueTimestamp: true, IncludeIssuedAt: true, TimestampFirst: true},
+	} {
+		token := config.GenerateToken(sessionId, expireAt, secret)
+
+		parsed, err := config.ParseToken(token)
+		if err != nil {
+			t.Errorf("%s: token parsing failed: token=%s, err=%s", name, token, err)
+			continue
+		}
+		if parsed.RawTimestamp != config.formatTimestamp(expireAt) {
+			t.Errorf("%s: timestamp was not isolated: token=%s, timestamp=%s", name, token, parsed.RawTimestamp)
+		}
+		if !config.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("%s: token validation failed: token=%s", name, token)
+		}
+	}
+
+	// the separator of opaque timestamps has to appear exactly before them
+	token := opaque.GenerateToken(sessionId, expireAt, secret)
+	for _, misplaced := range []string{token[:len(token)-1], token + "A", strings.Replace(token, "--", "-", 1)} {
+		if _, err := opaque.ParseToken(misplaced); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("token with a misplaced separator was expected to be malformed: token=%s, err=%v", misplaced, err)
+		}
+	}
+}
+
+func TestGenerateTokens(t *testing.T) {
+	sessionIds := []string{"user1-login", "user1-logout", "user1-delete"}
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	tokens := GenerateTokens(sessionIds, expireAt, secret)
+
+	if len(tokens) != len(sessionIds) {
+		t.Fatalf("%d tokens were expected, got: %d", len(sessionIds), len(tokens))
+	}
+	for i, sessionId := range sessionIds {
+		if tokens[i] != GenerateToken(sessionId, expireAt, secret) {
+			t.Errorf("batch token does not match GenerateToken: token=%s, sessionId=%s", tokens[i], sessionId)
+		}
+		if !ValidateToken(tokens[i], sessionId, now, secret) {
+			t.Errorf("token validation failed: token=%s, sessionId=%s", tokens[i], sessionId)
+		}
+	}
+}
+
+func BenchmarkGenerateTokens(b *testing.B) {
+	sessionIds := make([]string, 50)
+	for i := range sessionIds {
+		sessionIds[i] = "user1-operation" + strconv.Itoa(i)
+	}
+	secret := "LoremIpsum123"
+	expireAt := time.Now().Add(5 * time.Minute)
+
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			GenerateTokens(sessionIds, expireAt, secret)
+		}
+	})
+
+	b.Run("per-call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, sessionId := range sessionIds {
+				GenerateToken(sessionId, expireAt, secret)
+			}
+		}
+	})
+}
+
+func TestValidateTokens(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+	valid := GenerateToken("user1-login", now.Add(time.Minute), secret)
+	expired := GenerateToken("user2-login", now.Add(-time.Minute), secret)
+	other := GenerateToken("user3-login", now.Add(time.Minute), "DolorSitAmet456")
+
+	results, err := ValidateTokens(
+		[]string{valid, expired, other, "malformed", valid},
+		[]string{"user1-login", "user2-login", "user3-login", "user4-login", "user5-login"},
+		now, secret,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []bool{true, false, false, false, false}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("result %d was expected to be %v, got: %v", i, expected[i], results[i])
+		}
+	}
+
+	if _, err := ValidateTokens([]string{valid}, nil, now, secret); err != ErrLengthMismatch {
+		t.Errorf("ErrLengthMismatch was expected, got: %v", err)
+	}
+}
+
+func BenchmarkValidateTokens(b *testing.B) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+	sessionIds := make([]string, 50)
+	tokens := make([]string, 50)
+	for i := range sessionIds {
+		sessionIds[i] = "user1-operation" + strconv.Itoa(i)
+		tokens[i] = GenerateToken(sessionIds[i], now.Add(5*time.Minute), secret)
+	}
+
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ValidateTokens(tokens, sessionIds, now, secret)
+		}
+	})
+
+	b.Run("per-call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j, token := range tokens {
+				ValidateToken(token, sessionIds[j], now, secret)
+			}
+		}
+	})
+}
+
+func TestParseTokenReportsMalformationReason(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now(), "LoremIpsum123")
+	hash := strings.Split(token, TokenTimestampSeparator)[0]
+
+	for malformed, expected := range map[string]error{
+		hash:                                    ErrWrongSegments,
+		"":                                      ErrWrongSegments,
+		replaceTimestampInToken(token, "lorem"): ErrBadTimestamp,
+		hash + TokenTimestampSeparator:          ErrBadTimestamp,
+		token + ".loremipsum":                   ErrBadTimestamp,
+	} {
+		_, err := ParseToken(malformed)
+
+		if !errors.Is(err, expected) {
+			t.Errorf("token parsing was expected to fail with %v: token=%s, err=%v", expected, malformed, err)
+		}
+		if !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("token parsing error was expected to match ErrMalformedToken: token=%s, err=%v", malformed, err)
+		}
+	}
+
+	if _, err := ParseToken(replaceTimestampInToken(token, "lorem")); errors.Is(err, ErrWrongSegments) {
+		t.Errorf("bad timestamp was not expected to match ErrWrongSegments")
+	}
+}
+
+func TestValidateWithRemaining(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Unix(1609787986, 0)
+	token := GenerateToken(sessionId, now.Add(time.Hour), secret)
+
+	if valid, remaining := ValidateWithRemaining(token, sessionId, now, secret); !valid || remaining != time.Hour {
+		t.Errorf("fresh token was expected to be valid for an hour, got: %t, %s", valid, remaining)
+	}
+	if valid, remaining := ValidateWithRemaining(token, sessionId, now.Add(59*time.Minute), secret); !valid || remaining != time.Minute {
+		t.Errorf("token near expiry was expected to be valid for a minute, got: %t, %s", valid, remaining)
+	}
+	if valid, remaining := ValidateWithRemaining(token, "user2-login", now, secret); valid || remaining != 0 {
+		t.Errorf("invalid token was expected to have no remaining time, got: %t, %s", valid, remaining)
+	}
+	if valid, remaining := ValidateWithRemaining(token, sessionId, now.Add(2*time.Hour), secret); valid || remaining != 0 {
+		t.Errorf("expired token was expected to have no remaining time, got: %t, %s", valid, remaining)
+	}
+}
+
+func TestValidateTokenFunc(t *testing.T) {
+	now := time.Now()
+	secrets := map[string]string{
+		"tenantA-user1": "LoremIpsum123",
+		"tenantB-user1": "DolorSitAmet456",
+	}
+	secretFn := func(sessionId string) (string, error) {
+		secret, ok := secrets[sessionId]
+		if !ok {
+			return "", errors.New("unknown tenant")
+		}
+
+		return secret, nil
+	}
+
+	tokenA := GenerateToken("tenantA-user1", now.Add(time.Minute), "LoremIpsum123")
+	tokenB := GenerateToken("tenantB-user1", now.Add(time.Minute), "DolorSitAmet456")
+
+	if !ValidateTokenFunc(tokenA, "tenantA-user1", now, secretFn) || !ValidateTokenFunc(tokenB, "tenantB-user1", now, secretFn) {
+		t.Errorf("tokens were expected to be valid under their tenants' secrets")
+	}
+	if ValidateTokenFunc(tokenA, "tenantB-user1", now, secretFn) {
+		t.Errorf("token was expected to be invalid under other tenant")
+	}
+	if ValidateTokenFunc(tokenA, "tenantC-user1", now, secretFn) {
+		t.Errorf("token was expected to be invalid when the secret lookup fails")
+	}
+
+	called := false
+	ValidateTokenFunc("malformed", "tenantA-user1", now, func(sessionId string) (string, error) {
+		called = true
+		return "LoremIpsum123", nil
+	})
+	if called {
+		t.Errorf("secret was not expected to be looked up for a malformed token")
+	}
+}
+
+func TestValidateTokenFuncReportsMalformedTokens(t *testing.T) {
+	now := time.Now()
+	metrics := &fakeMetrics{}
+	config := &TokenConfig{StrictSecret: true, Metrics: metrics}
+	secretFn := func(sessionId string) (string, error) {
+		return "LoremIpsum123", nil
+	}
+
+	config.ValidateTokenFunc("malformed", "user1-login", now, secretFn)
+	config.ValidateTokenFunc(config.GenerateToken("user1-login", now.Add(time.Minute), "LoremIpsum123"), "user1-login", now, secretFn)
+	config.ValidateTokenFunc("x", "user1-login", now, func(sessionId string) (string, error) {
+		t.Errorf("secret was not expected to be looked up for a malformed token")
+		return "", nil
+	})
+
+	if got := strings.Join(metrics.validated, ","); got != "malformed,valid,malformed" {
+		t.Errorf("every validation was expected to be reported once with its reason, got: %s", got)
+	}
+}
+
+func TestFarFutureTimestampsAreMalformed(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		expireAt time.Time
+		reason   string
+	}{
+		{"MaxInt64", time.Unix(math.MaxInt64, 0), ReasonMalformed},
+		{"year 3000", time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), ReasonMalformed},
+		{"normal", now.Add(time.Hour), ""},
+	}
+
+	for _, tt := range tests {
+		token := GenerateToken(sessionId, tt.expireAt, secret)
+
+		if _, reason := defaultConfig.validate(nil, token, sessionId, now, secret); reason != tt.reason {
+			t.Errorf("%s: expected reason %q, got: %q", tt.name, tt.reason, reason)
+		}
+		if _, err := ParseToken(token); (err != nil) != (tt.reason != "") || (err != nil && !errors.Is(err, ErrBadTimestamp)) {
+			t.Errorf("%s: unexpected parse error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestTokenConfigHorizon(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	config := &TokenConfig{Horizon: now.Add(time.Hour)}
+
+	if !config.ValidateToken(config.GenerateToken(sessionId, now.Add(time.Minute), secret), sessionId, now, secret) {
+		t.Errorf("token expiring before the horizon was expected to be valid")
+	}
+	if config.ValidateToken(config.GenerateToken(sessionId, now.Add(2*time.Hour), secret), sessionId, now, secret) {
+		t.Errorf("token expiring after the horizon was expected to be invalid")
+	}
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+	fingerprint := TokenFingerprint(token)
+
+	if len(fingerprint) != 8 {
+		t.Errorf("fingerprint was expected to have 8 characters, got: %s", fingerprint)
+	}
+	if TokenFingerprint(token) != fingerprint {
+		t.Errorf("fingerprint was expected to be stable")
+	}
+	if hash := strings.Split(token, TokenTimestampSeparator)[0]; strings.Contains(token, fingerprint) || strings.HasPrefix(hash, fingerprint) {
+		t.Errorf("fingerprint was not expected to reveal the token: token=%s, fingerprint=%s", token, fingerprint)
+	}
+	if TokenFingerprint(token+"0") == fingerprint {
+		t.Errorf("fingerprints of different tokens were expected to differ")
+	}
+	if malformed := TokenFingerprint("not a token"); len(malformed) != 8 {
+		t.Errorf("malformed token was expected to have a fingerprint, got: %s", malformed)
+	}
+}
+
+func TestNonCanonicalTimestampsAreMalformed(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Unix(100, 0)
+	hash := hmacToken(crypto.SHA512_224, tokenContents(sessionId, "123"), secret)
+
+	if !ValidateToken(hash+TokenTimestampSeparator+"123", sessionId, now, secret) {
+		t.Errorf("token with canonical timestamp was expected to be valid")
+	}
+
+	for _, ts := range []string{"+123", "0123", " 123", "123 ", "-0", "", "-"} {
+		// sign the non-canonical timestamp itself, so only the encoding can make the token invalid
+		token := hmacToken(crypto.SHA512_224, tokenContents(sessionId, ts), secret) + TokenTimestampSeparator + ts
+
+		if _, reason := defaultConfig.validate(nil, token, sessionId, now, secret); reason != ReasonMalformed {
+			t.Errorf("token with timestamp %q was expected to be malformed, got reason: %q", ts, reason)
+		}
+	}
+}
+
+func TestValidateSignature(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	expired := GenerateToken(sessionId, now.Add(-time.Hour), secret)
+	if !ValidateSignature(expired, sessionId, secret) {
+		t.Errorf("expired but authentic token was expected to have a valid signature")
+	}
+	if ValidateToken(expired, sessionId, now, secret) {
+		t.Errorf("expired token was expected to be invalid")
+	}
+
+	forged := GenerateToken(sessionId, now.Add(time.Hour), "DolorSitAmet456")
+	if ValidateSignature(forged, sessionId, secret) || ValidateToken(forged, sessionId, now, secret) {
+		t.Errorf("forged token was expected to be invalid")
+	}
+
+	for _, malformed := range []string{"", "lorem", strings.Split(expired, TokenTimestampSeparator)[0], TokenTimestampSeparator + "1609787986"} {
+		if ValidateSignature(malformed, sessionId, secret) {
+			t.Errorf("malformed token was expected to have an invalid signature: %q", malformed)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestWriteToken(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(time.Minute)
+
+	var buf bytes.Buffer
+	n, err := WriteToken(&buf, sessionId, expireAt, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != GenerateToken(sessionId, expireAt, secret) || n != buf.Len() {
+		t.Errorf("written token was expected to equal the generated one: written=%s, n=%d", buf.String(), n)
+	}
+	if !ValidateToken(buf.String(), sessionId, now, secret) {
+		t.Errorf("written token was expected to be valid: %s", buf.String())
+	}
+
+	config := &TokenConfig{Versioned: true, IncludeIssuedAt: true, Clock: &FixedClock{Time: now}}
+	buf.Reset()
+	config.WriteToken(&buf, sessionId, expireAt, secret)
+	if buf.String() != config.GenerateToken(sessionId, expireAt, secret) {
+		t.Errorf("written token was expected to equal the generated one for the config: written=%s", buf.String())
+	}
+
+	if _, err := WriteToken(failingWriter{}, sessionId, expireAt, secret); err == nil {
+		t.Errorf("write error was expected to be returned")
+	}
+}
+
+func TestValidateTokenBytesTokenMatchesValidateToken(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(time.Minute), secret)
+	expired := GenerateToken(sessionId, now.Add(-time.Minute), secret)
+
+	for _, tc := range []struct {
+		token, sessionId string
+	}{
+		{token, sessionId},
+		{token, "user2-login"},
+		{expired, sessionId},
+		{token[1:], sessionId},
+		{token + ".1", sessionId},
+		{"", sessionId},
+	} {
+		expected := ValidateToken(tc.token, tc.sessionId, now, secret)
+		if got := ValidateTokenBytesToken([]byte(tc.token), tc.sessionId, now, secret); got != expected {
+			t.Errorf("validation of %q from bytes was expected to return %v, got %v", tc.token, expected, got)
+		}
+	}
+	if !ValidateTokenBytesToken([]byte(token), sessionId, now, secret) {
+		t.Errorf("token was expected to be valid")
+	}
+}
+
+func TestValidateTokenWithRevocation(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+	revokedSessions := map[string]bool{"user2-login": true}
+	called := 0
+	revoked := func(sessionId string) bool {
+		called++
+		return revokedSessions[sessionId]
+	}
+
+	if !ValidateTokenWithRevocation(GenerateToken("user1-login", now.Add(time.Minute), secret), "user1-login", now, secret, revoked) {
+		t.Errorf("token for a session that is not revoked was expected to be valid")
+	}
+	if ValidateTokenWithRevocation(GenerateToken("user2-login", now.Add(time.Minute), secret), "user2-login", now, secret, revoked) {
+		t.Errorf("token for a revoked session was expected to be invalid")
+	}
+
+	called = 0
+	if ValidateTokenWithRevocation(GenerateToken("user1-login", now.Add(-time.Minute), secret), "user1-login", now, secret, revoked) {
+		t.Errorf("expired token was expected to be invalid")
+	}
+	if called != 0 {
+		t.Errorf("revoked was not expected to be called for an invalid token, called %d times", called)
+	}
+
+	metrics := &fakeMetrics{}
+	var buf bytes.Buffer
+	config := &TokenConfig{Metrics: metrics, Slog: slog.New(slog.NewJSONHandler(&buf, nil))}
+	config.ValidateTokenWithRevocation(GenerateToken("user2-login", now.Add(time.Minute), secret), "user2-login", now, secret, revoked)
+	if strings.Join(metrics.validated, ",") != ReasonRevoked || !strings.Contains(buf.String(), `"valid":false,"reason":"revoked"`) {
+		t.Errorf("revoked token was expected to be reported once as revoked, got: %v, logged: %s", metrics.validated, buf.String())
+	}
+}
+
+func TestResign(t *testing.T) {
+	sessionId := "user1-login"
+	oldSecret := "LoremIpsum123"
+	newSecret := "DolorSitAmet456"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(time.Minute), oldSecret)
+
+	resigned, ok := Resign(token, sessionId, now, oldSecret, newSecret)
+	if !ok {
+		t.Fatalf("valid token was expected to be resigned")
+	}
+	if !ValidateToken(resigned, sessionId, now, newSecret) || ValidateToken(resigned, sessionId, now, oldSecret) {
+		t.Errorf("resigned token was expected to be valid only under the new secret: token=%s", resigned)
+	}
+
+	expiry, _ := TokenExpiry(token)
+	resignedExpiry, _ := TokenExpiry(resigned)
+	if !resignedExpiry.Equal(expiry) {
+		t.Errorf("resigned token was expected to keep the expiration date: expected=%s, got=%s", expiry, resignedExpiry)
+	}
+
+	for _, invalid := range []string{
+		GenerateToken(sessionId, now.Add(-time.Minute), oldSecret),
+		GenerateToken(sessionId, now.Add(time.Minute), newSecret),
+		GenerateToken("user2-login", now.Add(time.Minute), oldSecret),
+	} {
+		if resigned, ok := Resign(invalid, sessionId, now, oldSecret, newSecret); ok || resigned != "" {
+			t.Errorf("invalid token was not expected to be resigned: token=%s, resigned=%s", invalid, resigned)
+		}
+	}
+}
+
+func TestResignKeepsIssuedAt(t *testing.T) {
+	sessionId := "user1-login"
+	issuedAt := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	config := &TokenConfig{IncludeIssuedAt: true, Clock: &FixedClock{Time: issuedAt}}
+	token := config.GenerateToken(sessionId, issuedAt.Add(time.Hour), "LoremIpsum123")
+
+	resigned, ok := config.Resign(token, sessionId, issuedAt.Add(time.Minute), "LoremIpsum123", "DolorSitAmet456")
+	if !ok {
+		t.Fatalf("valid token was expected to be resigned")
+	}
+
+	original, _ := config.ParseToken(token)
+	parsed, err := config.ParseToken(resigned)
+	if err != nil || !parsed.IssuedAt.Equal(original.IssuedAt) || !parsed.ExpiresAt.Equal(original.ExpiresAt) {
+		t.Errorf("resigned token was expected to keep the timestamps: original=%s, resigned=%s", token, resigned)
+	}
+}
+
+func TestValidateAndParse(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(time.Minute)
+	token := GenerateToken(sessionId, expireAt, secret)
+
+	parsed, valid := ValidateAndParse(token, sessionId, now, secret)
+	if !valid || parsed == nil {
+		t.Fatalf("token was expected to be valid: %s", token)
+	}
+	if !parsed.ExpiresAt.Equal(time.Unix(expireAt.Unix(), 0)) {
+		t.Errorf("parsed expiration date was expected to be %s, got: %s", time.Unix(expireAt.Unix(), 0), parsed.ExpiresAt)
+	}
+	if parsed.Hash != strings.Split(token, TokenTimestampSeparator)[0] {
+		t.Errorf("parsed hash does not match the token: %s", parsed.Hash)
+	}
+
+	for _, invalid := range []string{"malformed", GenerateToken("user2-login", expireAt, secret), GenerateToken(sessionId, now.Add(-time.Minute), secret)} {
+		if parsed, valid := ValidateAndParse(invalid, sessionId, now, secret); valid || parsed != nil {
+			t.Errorf("invalid token was expected to return nil: token=%s, parsed=%v", invalid, parsed)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	if reasons := Diagnose(GenerateToken(sessionId, now.Add(time.Minute), secret), sessionId, now, secret); reasons != nil {
+		t.Errorf("valid token was not expected to have reasons, got: %v", reasons)
+	}
+
+	forged := GenerateToken(sessionId, now.Add(-time.Minute), "DolorSitAmet456")
+	reasons := Diagnose(forged, sessionId, now, secret)
+	if len(reasons) != 2 || reasons[0] != ReasonMismatch || reasons[1] != ReasonExpired {
+		t.Errorf("expired forged token was expected to be reported as mismatched and expired, got: %v", reasons)
+	}
+
+	if reasons := Diagnose("malformed", sessionId, now, secret); len(reasons) != 1 || reasons[0] != ReasonMalformed {
+		t.Errorf("malformed token was expected to be reported as malformed, got: %v", reasons)
+	}
+
+	issuedAt := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	config := &TokenConfig{IncludeIssuedAt: true, MaxAge: time.Minute, Clock: &FixedClock{Time: issuedAt}}
+	token := config.GenerateToken(sessionId, issuedAt.Add(time.Minute), secret)
+	reasons = config.Diagnose(token, "user2-login", issuedAt.Add(time.Hour), secret)
+	if len(reasons) != 3 || reasons[0] != ReasonMismatch || reasons[1] != ReasonExpired || reasons[2] != ReasonTooOld {
+		t.Errorf("token was expected to be reported as mismatched, expired and too old, got: %v", reasons)
+	}
+}
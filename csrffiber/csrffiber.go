@@ -0,0 +1,95 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package csrffiber protects Fiber applications against CSRF with HMAC Based CSRF Tokens.
+package csrffiber
+
+import (
+	"csrf"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Config configures the handler returned by New.
+type Config struct {
+	// Token is used to generate and validate the tokens, the zero csrf.TokenConfig by default.
+	Token *csrf.TokenConfig
+	// Secret is used to generate and validate the tokens.
+	Secret string
+	// TTL is the lifetime of issued tokens, one hour by default.
+	TTL time.Duration
+	// SessionId returns the sessionId of the request, see csrf.GenerateToken for details.
+	SessionId func(c *fiber.Ctx) string
+	// HeaderName is the request header carrying the token, "X-CSRF-Token" by default.
+	HeaderName string
+	// FieldName is the form field carrying the token, used when the header is empty, "csrf_token" by default.
+	FieldName string
+	// LocalsKey is the c.Locals key the fresh token is stored under, "csrf_token" by default.
+	LocalsKey string
+}
+
+// New returns a Fiber handler protecting the application against CSRF.
+// Requests with unsafe methods must carry a valid token, otherwise fiber.ErrForbidden is returned.
+// Every request that passes gets a fresh token in c.Locals.
+func New(config Config) fiber.Handler {
+	if config.Token == nil {
+		config.Token = &csrf.TokenConfig{}
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Hour
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	if config.FieldName == "" {
+		config.FieldName = "csrf_token"
+	}
+	if config.LocalsKey == "" {
+		config.LocalsKey = "csrf_token"
+	}
+
+	return func(c *fiber.Ctx) error {
+		sessionId := config.SessionId(c)
+
+		if !isSafeMethod(c.Method()) {
+			token := c.Get(config.HeaderName)
+			if token == "" {
+				token = c.FormValue(config.FieldName)
+			}
+
+			if !config.Token.ValidateTokenNow(token, sessionId, config.Secret) {
+				return fiber.ErrForbidden
+			}
+		}
+
+		c.Locals(config.LocalsKey, config.Token.GenerateTokenTTL(sessionId, config.TTL, config.Secret))
+
+		return c.Next()
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,102 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrffiber
+
+import (
+	"csrf"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func testApp() *fiber.App {
+	app := fiber.New()
+	app.Use(New(Config{
+		Secret: "LoremIpsum123",
+		SessionId: func(c *fiber.Ctx) string {
+			return "user1-login"
+		},
+	}))
+	app.All("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("csrf_token").(string))
+	})
+
+	return app
+}
+
+func TestIssuesTokenOnSafeRequest(t *testing.T) {
+	resp, err := testApp().Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != fiber.StatusOK || !csrf.ValidateToken(string(body), "user1-login", time.Now(), "LoremIpsum123") {
+		t.Errorf("valid token was expected: status=%d, token=%s", resp.StatusCode, body)
+	}
+}
+
+func TestAcceptsValidTokenInHeader(t *testing.T) {
+	r := httptest.NewRequest(fiber.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", csrf.GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+
+	resp, err := testApp().Test(r)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", resp.StatusCode)
+	}
+}
+
+func TestAcceptsValidTokenInForm(t *testing.T) {
+	form := url.Values{"csrf_token": {csrf.GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")}}
+	r := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", fiber.MIMEApplicationForm)
+
+	resp, err := testApp().Test(r)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", resp.StatusCode)
+	}
+}
+
+func TestRejectsInvalidToken(t *testing.T) {
+	r := httptest.NewRequest(fiber.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", csrf.GenerateToken("user2-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+
+	resp, err := testApp().Test(r)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("request was expected to be rejected, got status: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,101 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package csrftest produces valid and tampered tokens for testing code protected with the csrf package.
+package csrftest
+
+import (
+	"csrf"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tampering alters a token generated by csrf.GenerateToken.
+type Tampering func(token string) string
+
+// ValidToken returns a token for the sessionId, signed with the secret, expiring in an hour.
+func ValidToken(sessionId, secret string) string {
+	return csrf.GenerateToken(sessionId, time.Now().Add(time.Hour), secret)
+}
+
+// Tamper applies the tamperings to the token, in order.
+func Tamper(token string, tamperings ...Tampering) string {
+	for _, tamper := range tamperings {
+		token = tamper(token)
+	}
+
+	return token
+}
+
+// Timestamp replaces the expiration date of the token, keeping its hash.
+func Timestamp(expireAt time.Time) Tampering {
+	return func(token string) string {
+		hash, _ := split(token)
+
+		return hash + csrf.TokenTimestampSeparator + strconv.FormatInt(expireAt.Unix(), 10)
+	}
+}
+
+// TruncateHash removes the last character of the hash.
+func TruncateHash() Tampering {
+	return func(token string) string {
+		hash, ts := split(token)
+		if hash == "" {
+			return token
+		}
+
+		return hash[:len(hash)-1] + csrf.TokenTimestampSeparator + ts
+	}
+}
+
+// FlipHashByte changes the hex digit of the hash at index i to another hex digit, so the hash stays well-formed.
+func FlipHashByte(i int) Tampering {
+	return func(token string) string {
+		hash, ts := split(token)
+		if i < 0 || i >= len(hash) {
+			return token
+		}
+
+		digit, err := strconv.ParseUint(hash[i:i+1], 16, 8)
+		if err != nil {
+			digit = 0
+		}
+		flipped := strconv.FormatUint(digit^1, 16)
+
+		return hash[:i] + flipped + hash[i+1:] + csrf.TokenTimestampSeparator + ts
+	}
+}
+
+// ExtraSegment appends the segment to the token, after a separator.
+func ExtraSegment(segment string) Tampering {
+	return func(token string) string {
+		return token + csrf.TokenTimestampSeparator + segment
+	}
+}
+
+// split returns the hash and the timestamp of the token.
+func split(token string) (string, string) {
+	i := strings.LastIndex(token, csrf.TokenTimestampSeparator)
+	if i < 0 {
+		return token, ""
+	}
+
+	return token[:i], token[i+len(csrf.TokenTimestampSeparator):]
+}
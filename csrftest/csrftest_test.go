@@ -0,0 +1,69 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrftest
+
+import (
+	"csrf"
+	"testing"
+	"time"
+)
+
+func TestValidToken(t *testing.T) {
+	if !csrf.ValidateToken(ValidToken("user1-login", "LoremIpsum123"), "user1-login", time.Now(), "LoremIpsum123") {
+		t.Errorf("token was expected to be valid")
+	}
+}
+
+func TestTamperedTokensAreInvalid(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := ValidToken(sessionId, secret)
+
+	tamperings := map[string]Tampering{
+		"timestamp":      Timestamp(now.Add(2 * time.Hour)),
+		"truncated hash": TruncateHash(),
+		"flipped first":  FlipHashByte(0),
+		"flipped last":   FlipHashByte(55),
+		"extra segment":  ExtraSegment("1609787986"),
+	}
+
+	for name, tampering := range tamperings {
+		tampered := Tamper(token, tampering)
+
+		if tampered == token {
+			t.Errorf("%s: token was expected to change", name)
+		}
+		if csrf.ValidateToken(tampered, sessionId, now, secret) {
+			t.Errorf("%s: tampered token was expected to be invalid: %s", name, tampered)
+		}
+	}
+}
+
+func TestTamperAppliesInOrder(t *testing.T) {
+	token := "abc.1609787986"
+
+	if tampered := Tamper(token, TruncateHash(), ExtraSegment("x")); tampered != "ab.1609787986.x" {
+		t.Errorf("unexpected tampered token: %s", tampered)
+	}
+	if tampered := Tamper(token, FlipHashByte(2)); tampered != "abd.1609787986" {
+		t.Errorf("unexpected tampered token: %s", tampered)
+	}
+}
@@ -0,0 +1,108 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import "time"
+
+// ValidationError describes why a token was rejected. Error returns the detailed reason, meant for server logs,
+// and ClientError a generic message, safe to send to clients. It is a comparable value, so the errors below can't
+// be altered by their users.
+type ValidationError struct {
+	reason string
+}
+
+// Errors returned by ValidateTokenErr, one for every reason it reports. The ones for malformed tokens, unsupported
+// versions and empty secrets also match ErrMalformedToken, ErrUnsupportedVersion and ErrEmptySecret respectively.
+var (
+	ErrTokenMalformed          = ValidationError{reason: ReasonMalformed}
+	ErrTokenUnsupportedVersion = ValidationError{reason: ReasonUnsupportedVersion}
+	ErrTokenExpired            = ValidationError{reason: ReasonExpired}
+	ErrTokenIssuedInFuture     = ValidationError{reason: ReasonIssuedInFuture}
+	ErrTokenTooOld             = ValidationError{reason: ReasonTooOld}
+	ErrTokenMismatch           = ValidationError{reason: ReasonMismatch}
+	ErrTokenEmptySecret        = ValidationError{reason: ReasonEmptySecret}
+)
+
+// clientErrorMessage is the message of every ValidationError shown to clients.
+const clientErrorMessage = "invalid CSRF token"
+
+// Reason returns one of the Reason constants.
+func (e ValidationError) Reason() string {
+	return e.reason
+}
+
+func (e ValidationError) Error() string {
+	return "csrf: token rejected: " + e.reason
+}
+
+// Unwrap returns the parsing or secret error matching the reason, e.g. ErrMalformedToken for ReasonMalformed,
+// or nil when there is none.
+func (e ValidationError) Unwrap() error {
+	switch e.reason {
+	case ReasonMalformed:
+		return ErrMalformedToken
+	case ReasonUnsupportedVersion:
+		return ErrUnsupportedVersion
+	case ReasonEmptySecret:
+		return ErrEmptySecret
+	default:
+		return nil
+	}
+}
+
+// ClientError returns "invalid CSRF token" whatever the reason, so clients can't tell if the secret, the sessionId
+// or the signature was the problem.
+func (e ValidationError) ClientError() string {
+	return clientErrorMessage
+}
+
+// ValidateTokenErr works like ValidateToken, but returns the ValidationError describing the rejection, nil for valid tokens.
+// See TokenConfig.ValidateTokenErr for details.
+func ValidateTokenErr(token, sessionId string, now time.Time, secret string) error {
+	return defaultConfig.ValidateTokenErr(token, sessionId, now, secret)
+}
+
+// ValidateTokenErr works like ValidateToken, but returns the ValidationError describing the rejection, one of the
+// ErrToken errors, or nil for valid tokens.
+func (c *TokenConfig) ValidateTokenErr(token, sessionId string, now time.Time, secret string) error {
+	parsed, reason := c.validate(nil, token, sessionId, now, secret)
+	c.report(token, sessionId, &parsed, reason)
+
+	switch reason {
+	case "":
+		return nil
+	case ReasonMalformed:
+		return ErrTokenMalformed
+	case ReasonUnsupportedVersion:
+		return ErrTokenUnsupportedVersion
+	case ReasonExpired:
+		return ErrTokenExpired
+	case ReasonIssuedInFuture:
+		return ErrTokenIssuedInFuture
+	case ReasonTooOld:
+		return ErrTokenTooOld
+	case ReasonMismatch:
+		return ErrTokenMismatch
+	case ReasonEmptySecret:
+		return ErrTokenEmptySecret
+	default:
+		return ValidationError{reason: reason}
+	}
+}
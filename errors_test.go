@@ -0,0 +1,93 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTokenErr(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	issuedAt := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	config := &TokenConfig{IncludeIssuedAt: true, MaxAge: time.Minute, Clock: &FixedClock{Time: issuedAt}}
+	token := config.GenerateToken(sessionId, issuedAt.Add(time.Hour), secret)
+
+	if err := config.ValidateTokenErr(token, sessionId, issuedAt, secret); err != nil {
+		t.Errorf("valid token was not expected to fail, got: %v", err)
+	}
+
+	for _, tc := range []struct {
+		config    *TokenConfig
+		token     string
+		sessionId string
+		now       time.Time
+		secret    string
+		expected  error
+	}{
+		{config, "malformed", sessionId, issuedAt, secret, ErrTokenMalformed},
+		{&TokenConfig{Versioned: true}, "v9." + token, sessionId, issuedAt, secret, ErrTokenUnsupportedVersion},
+		{config, config.GenerateToken(sessionId, issuedAt.Add(-time.Second), secret), sessionId, issuedAt, secret, ErrTokenExpired},
+		{config, token, sessionId, issuedAt.Add(-time.Second), secret, ErrTokenIssuedInFuture},
+		{config, token, sessionId, issuedAt.Add(2 * time.Minute), secret, ErrTokenTooOld},
+		{config, token, "user2-login", issuedAt, secret, ErrTokenMismatch},
+		{&TokenConfig{IncludeIssuedAt: true, StrictSecret: true}, token, sessionId, issuedAt, "", ErrTokenEmptySecret},
+	} {
+		err := tc.config.ValidateTokenErr(tc.token, tc.sessionId, tc.now, tc.secret)
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("%v was expected, got: %v", tc.expected, err)
+			continue
+		}
+
+		var validationErr ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("ValidationError was expected, got: %T", err)
+		}
+		if validationErr.ClientError() != "invalid CSRF token" {
+			t.Errorf("client error was expected to be generic, got: %s", validationErr.ClientError())
+		}
+		if !strings.Contains(err.Error(), validationErr.Reason()) {
+			t.Errorf("error was expected to contain the reason %s, got: %s", validationErr.Reason(), err.Error())
+		}
+	}
+}
+
+func TestValidationErrorMatchesParsingErrors(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(time.Minute), secret)
+
+	if err := ValidateTokenErr("malformed", sessionId, now, secret); !errors.Is(err, ErrMalformedToken) {
+		t.Errorf("ErrMalformedToken was expected to match, got: %v", err)
+	}
+	if err := (&TokenConfig{Versioned: true}).ValidateTokenErr("v9."+token, sessionId, now, secret); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("ErrUnsupportedVersion was expected to match, got: %v", err)
+	}
+	if err := (&TokenConfig{StrictSecret: true}).ValidateTokenErr(token, sessionId, now, ""); !errors.Is(err, ErrEmptySecret) {
+		t.Errorf("ErrEmptySecret was expected to match, got: %v", err)
+	}
+	if err := ValidateTokenErr(token, "user2-login", now, secret); errors.Is(err, ErrMalformedToken) {
+		t.Errorf("ErrMalformedToken was not expected to match a mismatch, got: %v", err)
+	}
+}
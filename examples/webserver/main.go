@@ -0,0 +1,115 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Command webserver is an example of protecting HTML forms with csrf.Middleware.
+//
+// Every visitor gets a random session cookie, kept in memory. The middleware issues a token bound to the session on
+// GET, the form carries it in a hidden field, and the middleware validates it on POST.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"csrf"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var form = template.Must(template.New("form").Parse(`<!DOCTYPE html>
+<form method="post" action="/comment">
+	<input type="hidden" name="csrf_token" value="{{.}}">
+	<textarea name="comment"></textarea>
+	<button type="submit">Send</button>
+</form>
+`))
+
+type sessionKey struct{}
+
+// sessions holds the session IDs issued by the server.
+type sessions struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// middleware makes sure the request has a known session, issuing a new session cookie when it doesn't.
+func (s *sessions) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id string
+		if c, err := r.Cookie("session"); err == nil && s.known(c.Value) {
+			id = c.Value
+		} else {
+			id = s.create()
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: id, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, id)))
+	})
+}
+
+func (s *sessions) known(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ids[id]
+}
+
+func (s *sessions) create() string {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	id := hex.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = true
+
+	return id
+}
+
+func newServer(secret string) http.Handler {
+	protect := csrf.Middleware(csrf.MiddlewareConfig{
+		Secret: secret,
+		TTL:    time.Hour,
+		SessionId: func(r *http.Request) string {
+			return "session_" + r.Context().Value(sessionKey{}).(string) + "_comment"
+		},
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		form.Execute(w, csrf.TokenFromContext(r.Context()))
+	})
+	mux.HandleFunc("POST /comment", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "comment saved: %s\n", r.PostFormValue("comment"))
+	})
+
+	s := &sessions{ids: make(map[string]bool)}
+
+	return s.middleware(protect(mux))
+}
+
+func main() {
+	log.Fatal(http.ListenAndServe(":8080", newServer("MySuperSecretKey")))
+}
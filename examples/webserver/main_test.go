@@ -0,0 +1,108 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var tokenField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func fetchToken(t *testing.T, client *http.Client, server *httptest.Server) string {
+	res, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	match := tokenField.FindSubmatch(body)
+	if match == nil {
+		t.Fatalf("form was expected to contain the token field: %s", body)
+	}
+
+	return string(match[1])
+}
+
+func postComment(t *testing.T, client *http.Client, server *httptest.Server, token string) (int, string) {
+	res, err := client.PostForm(server.URL+"/comment", url.Values{"csrf_token": {token}, "comment": {"Lorem ipsum"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+
+	return res.StatusCode, string(body)
+}
+
+func newClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+
+	return &http.Client{Jar: jar}
+}
+
+func TestFormFlow(t *testing.T) {
+	server := httptest.NewServer(newServer("LoremIpsum123"))
+	defer server.Close()
+	client := newClient()
+
+	token := fetchToken(t, client, server)
+
+	if code, body := postComment(t, client, server, token); code != http.StatusOK || !strings.Contains(body, "comment saved") {
+		t.Errorf("comment with the token was expected to be saved, got: %d %s", code, body)
+	}
+}
+
+func TestFormFlowRejectsTamperedToken(t *testing.T) {
+	server := httptest.NewServer(newServer("LoremIpsum123"))
+	defer server.Close()
+	client := newClient()
+
+	token := fetchToken(t, client, server)
+	tampered := "0" + token[1:]
+	if token[0] == '0' {
+		tampered = "1" + token[1:]
+	}
+
+	if code, _ := postComment(t, client, server, tampered); code != http.StatusForbidden {
+		t.Errorf("comment with tampered token was expected to be rejected, got: %d", code)
+	}
+}
+
+func TestFormFlowRejectsTokenOfOtherSession(t *testing.T) {
+	server := httptest.NewServer(newServer("LoremIpsum123"))
+	defer server.Close()
+
+	token := fetchToken(t, newClient(), server)
+	other := newClient()
+	fetchToken(t, other, server)
+
+	if code, _ := postComment(t, other, server, token); code != http.StatusForbidden {
+		t.Errorf("comment with token of other session was expected to be rejected, got: %d", code)
+	}
+}
@@ -0,0 +1,90 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The free GenerateToken and ValidateToken use the functions below, specialised for the zero TokenConfig:
+// HMAC-SHA-512/224 of "sessionId|timestamp", hex encoded, with a decimal expiration date. They skip the options,
+// the Metrics and the io.Writer of the configurable path, while producing and accepting exactly the same tokens.
+// In BenchmarkDefaultFastPath, generation is about 10% faster with one allocation instead of four, and validation
+// about 6% faster - the HMAC itself dominates both.
+
+// defaultMaxTokenLength is the MaxTokenLength of the zero TokenConfig.
+var defaultMaxTokenLength = (&TokenConfig{}).maxTokenLength()
+
+// generateDefault generates the token GenerateToken of the zero TokenConfig generates.
+func generateDefault(sessionId string, expireAt time.Time, secret string) string {
+	m := getMac(crypto.SHA512_224)
+	defer putMac(crypto.SHA512_224, m)
+
+	m.buf = append(m.buf[:0], sessionId...)
+	m.buf = append(m.buf, '|')
+	m.buf = strconv.AppendInt(m.buf, expireAt.Unix(), 10)
+	hash := m.hexSum(secret)
+
+	token := append(m.scratch[:0], hash...)
+	token = append(token, TokenTimestampSeparator...)
+	token = append(token, m.buf[len(sessionId)+1:]...)
+	m.scratch = token
+
+	return string(token)
+}
+
+// validateDefault reports whether ValidateToken of the zero TokenConfig accepts the token.
+func validateDefault(token, sessionId string, now time.Time, secret string) bool {
+	if len(token) > defaultMaxTokenLength {
+		return false
+	}
+
+	i := strings.LastIndex(token, TokenTimestampSeparator)
+	if i < 0 {
+		return false
+	}
+	hash, timestamp := token[:i], token[i+len(TokenTimestampSeparator):]
+
+	expiresAt, err := defaultConfig.parseTimestamp(timestamp)
+	if err != nil || !isHex(hash, false) {
+		return false
+	}
+
+	m := getMac(crypto.SHA512_224)
+	defer putMac(crypto.SHA512_224, m)
+
+	m.buf = append(m.buf[:0], sessionId...)
+	m.buf = append(m.buf, '|')
+	m.buf = append(m.buf, timestamp...)
+	hashSample := m.hexSum(secret)
+	m.scratch = append(m.scratch[:0], hash...)
+
+	// like in checkSignature, the HMAC is compared before anything else is rejected
+	match := subtle.ConstantTimeCompare(m.scratch, hashSample)
+	if hash == "" || match != 1 {
+		return false
+	}
+
+	return !expiresAt.Before(now)
+}
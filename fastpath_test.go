@@ -0,0 +1,107 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultFastPathMatchesConfigurablePath(t *testing.T) {
+	defer func(separator string) {
+		TokenTimestampSeparator = separator
+	}(TokenTimestampSeparator)
+
+	r := rand.New(rand.NewPCG(1, 2))
+	now := time.Now()
+	config := &TokenConfig{}
+
+	for _, separator := range []string{".", ":", "a"} {
+		TokenTimestampSeparator = separator
+
+		for i := 0; i < 200; i++ {
+			sessionId, secret := randomString(r), randomString(r)
+			expireAt := now.Add(time.Duration(r.Int64N(int64(2*time.Hour))) - time.Hour)
+
+			token := GenerateToken(sessionId, expireAt, secret)
+			if generic := config.GenerateToken(sessionId, expireAt, secret); token != generic {
+				t.Fatalf("fast path token does not match: fast=%q, generic=%q", token, generic)
+			}
+
+			for _, candidate := range []string{
+				token,
+				token[1:],
+				strings.ToUpper(token),
+				token + "0",
+				token + separator + "1",
+				separator + token[strings.LastIndex(token, separator)+len(separator):],
+				"",
+				GenerateToken(sessionId, time.Unix(-1, 0), secret),
+				GenerateToken(sessionId, defaultHorizon.Add(time.Second), secret),
+			} {
+				for _, validatedSession := range []string{sessionId, "user1-login"} {
+					fast := ValidateToken(candidate, validatedSession, now, secret)
+					if generic := config.ValidateToken(candidate, validatedSession, now, secret); fast != generic {
+						t.Errorf("fast path validation of %q does not match: fast=%v, generic=%v", candidate, fast, generic)
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkDefaultFastPath(b *testing.B) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+	token := GenerateToken(sessionId, expireAt, secret)
+	config := &TokenConfig{}
+
+	b.Run("generate/fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			GenerateToken(sessionId, expireAt, secret)
+		}
+	})
+
+	b.Run("generate/configurable", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			config.GenerateToken(sessionId, expireAt, secret)
+		}
+	})
+
+	b.Run("validate/fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ValidateToken(token, sessionId, now, secret)
+		}
+	})
+
+	b.Run("validate/configurable", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			config.ValidateToken(token, sessionId, now, secret)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenHandler(t *testing.T) {
+	handler := TokenHandler("LoremIpsum123", 5*time.Minute, func(r *http.Request) string {
+		return "user1-login"
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/csrf", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type was expected to be application/json, got: %s", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control was expected to be no-store, got: %s", cc)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not valid JSON: %s", w.Body.String())
+	}
+	if len(body) != 2 {
+		t.Errorf("response was expected to contain only token and expiresAt: %s", w.Body.String())
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, body["expiresAt"])
+	if err != nil {
+		t.Fatalf("expiresAt is not a valid RFC 3339 date: %s", body["expiresAt"])
+	}
+	if embedded, _ := TokenExpiry(body["token"]); !embedded.Equal(expiresAt) {
+		t.Errorf("expiresAt does not match the token: expiresAt=%s, embedded=%s", expiresAt, embedded)
+	}
+
+	if !ValidateToken(body["token"], "user1-login", time.Now(), "LoremIpsum123") {
+		t.Errorf("returned token is invalid: token=%s", body["token"])
+	}
+}
@@ -0,0 +1,133 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// jwtTag is appended to the MAC input of JWTCodec tokens, so their MAC never matches the one of the Signer or of a token.
+const jwtTag = "|jwt"
+
+// JWTCodec is a Codec of tokens in the compact form of a JSON Web Token, for clients expecting that shape:
+// base64url(header).base64url(payload).base64url(mac). The header names the MAC algorithm, the payload holds
+// the SHA-256 of the sessionId and the expiration date, and the MAC covers both, computed with the HMAC of the config.
+// The tokens are not standard JWTs: the MAC algorithm is the one of the config, e.g. "HMAC-SHA-512/224".
+type JWTCodec struct {
+	// Config is used to compute the MAC, the zero TokenConfig by default.
+	Config *TokenConfig
+	// Secret is used to compute the MAC.
+	Secret string
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+type jwtPayload struct {
+	// Session is the base64url encoded SHA-256 of the sessionId, so the sessionId is not disclosed
+	Session string `json:"sid"`
+	Expiry  int64  `json:"exp"`
+}
+
+// Generate generates a token for the session, expiring at expireAt.
+func (c *JWTCodec) Generate(sessionId string, expireAt time.Time) string {
+	signed := c.header() + "." + jwtEncode(jwtPayload{Session: jwtSession(sessionId), Expiry: expireAt.Unix()})
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(c.mac(signed))
+}
+
+// Validate checks the MAC of the token, then that it was generated for the session and has not expired at now.
+// Tokens with a header other than the one Generate produces are rejected, and so are all tokens for an empty Secret
+// with StrictSecret.
+func (c *JWTCodec) Validate(token, sessionId string, now time.Time) bool {
+	if c.config().StrictSecret && c.Secret == "" {
+		return false
+	}
+
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	signed, encodedMac := token[:i], token[i+1:]
+
+	header, encodedPayload, ok := strings.Cut(signed, ".")
+	if !ok || header != c.header() {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.Strict().DecodeString(encodedMac)
+	if err != nil || subtle.ConstantTimeCompare(c.mac(signed), mac) != 1 {
+		return false
+	}
+
+	var payload jwtPayload
+	raw, err := base64.RawURLEncoding.Strict().DecodeString(encodedPayload)
+	if err != nil || json.Unmarshal(raw, &payload) != nil {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(payload.Session), []byte(jwtSession(sessionId))) != 1 {
+		return false
+	}
+
+	return !time.Unix(payload.Expiry, 0).Before(now)
+}
+
+// mac returns the MAC of the encoded header and payload.
+func (c *JWTCodec) mac(signed string) []byte {
+	return c.config().taggedMAC(c.Secret, []byte(signed), jwtTag)
+}
+
+// header returns the encoded header of the tokens.
+func (c *JWTCodec) header() string {
+	algorithm, _ := c.config().HashInfo()
+
+	return jwtEncode(jwtHeader{Algorithm: algorithm, Type: "JWT"})
+}
+
+func (c *JWTCodec) config() *TokenConfig {
+	if c.Config == nil {
+		return defaultConfig
+	}
+
+	return c.Config
+}
+
+// jwtEncode returns the base64url encoded JSON of v, which always succeeds for the types of JWTCodec.
+func jwtEncode(v any) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// jwtSession returns the base64url encoded SHA-256 of the sessionId.
+func jwtSession(sessionId string) string {
+	sum := sha256.Sum256([]byte(sessionId))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
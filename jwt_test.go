@@ -0,0 +1,116 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWTCodec(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	codec := &JWTCodec{Secret: secret}
+
+	token := codec.Generate(sessionId, now.Add(time.Minute))
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		t.Fatalf("token was expected to have three segments: token=%s", token)
+	}
+	header, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil || string(header) != `{"alg":"HMAC-SHA-512/224","typ":"JWT"}` {
+		t.Errorf("header was expected to name the algorithm, got: %s", header)
+	}
+	if strings.Contains(token, sessionId) {
+		t.Errorf("token was not expected to disclose the sessionId: token=%s", token)
+	}
+
+	if !codec.Validate(token, sessionId, now) {
+		t.Errorf("token was expected to be valid")
+	}
+	if codec.Validate(token, "user2-login", now) {
+		t.Errorf("token was expected to be invalid for another session")
+	}
+	if codec.Validate(token, sessionId, now.Add(2*time.Minute)) {
+		t.Errorf("expired token was expected to be invalid")
+	}
+	if (&JWTCodec{Secret: "LoremIpsum124"}).Validate(token, sessionId, now) {
+		t.Errorf("token was expected to be invalid with another secret")
+	}
+	if (&JWTCodec{Config: &TokenConfig{Hash: crypto.SHA256}, Secret: secret}).Validate(token, sessionId, now) {
+		t.Errorf("token was expected to be invalid with another algorithm")
+	}
+	if (&HMACCodec{Secret: secret}).Validate(token, sessionId, now) {
+		t.Errorf("JWT token was not expected to be valid as a regular token")
+	}
+}
+
+func TestJWTCodecRejectsAlteredPayload(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	codec := &JWTCodec{Secret: secret}
+	segments := strings.Split(codec.Generate(sessionId, now.Add(time.Minute)), ".")
+
+	extended, _ := json.Marshal(jwtPayload{Session: jwtSession(sessionId), Expiry: now.Add(time.Hour).Unix()})
+	altered := segments[0] + "." + base64.RawURLEncoding.EncodeToString(extended) + "." + segments[2]
+	if codec.Validate(altered, sessionId, now.Add(2*time.Minute)) {
+		t.Errorf("token with an altered payload was expected to be invalid: token=%s", altered)
+	}
+
+	swapped := segments[1] + "." + segments[0] + "." + segments[2]
+	for _, malformed := range []string{"", ".", "..", segments[0] + "." + segments[1], swapped} {
+		if codec.Validate(malformed, sessionId, now) {
+			t.Errorf("malformed token was expected to be invalid: token=%s", malformed)
+		}
+	}
+}
+
+func TestSignerNeverMatchesJWTMAC(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	codec := &JWTCodec{Secret: secret}
+
+	signed := codec.header() + "." + jwtEncode(jwtPayload{Session: jwtSession(sessionId), Expiry: now.Add(time.Hour).Unix()})
+	forged := signed + "." + base64.RawURLEncoding.EncodeToString(Signer(secret)([]byte(signed)))
+	if codec.Validate(forged, sessionId, now) {
+		t.Errorf("Signer output was not expected to be a valid JWT MAC: token=%s", forged)
+	}
+}
+
+func TestMiddlewareUsesJWTCodec(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.Codec = &JWTCodec{Secret: config.Secret}
+
+	_, token := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/", nil))
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", token)
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusOK {
+		t.Errorf("JWT token issued by the middleware was expected to pass, got status: %d", w.Code)
+	}
+}
@@ -0,0 +1,258 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// MACMode selects the MAC tokens are signed with.
+type MACMode int
+
+const (
+	// HMAC signs tokens with HMAC of TokenConfig.Hash, the default.
+	HMAC MACMode = iota
+	// BLAKE2Keyed signs tokens with BLAKE2b-512 in its native keyed mode, which is faster than HMAC.
+	// TokenConfig.Hash is ignored.
+	BLAKE2Keyed
+)
+
+// blake2KeyedTag is prepended to the MAC input of BLAKE2Keyed, so it never matches the input of another MAC.
+const blake2KeyedTag = "BLAKE2b-512 keyed|"
+
+// macPool identifies the pool of macStates for a hash and a mode.
+type macPool struct {
+	hash crypto.Hash
+	mode MACMode
+}
+
+// macPools holds a *sync.Pool of *macState for every macPool,
+// so computing HMAC does not allocate on the hot path.
+var macPools sync.Map
+
+// testHookHMAC is called for every computed HMAC, so tests can tell if validation reached the HMAC.
+var testHookHMAC func()
+
+// macState computes HMAC (RFC 2104) with reusable hash states and buffers.
+type macState struct {
+	inner, outer hash.Hash
+	ipad, opad   []byte
+	// algorithm is prepended to the MAC input, see algorithmPrefix and blake2KeyedTag
+	algorithm []byte
+	// keyed computes the BLAKE2Keyed MAC with the key set for keyedSecret, nil in HMAC mode
+	keyed       hash.Hash
+	keyedSecret string
+	blake2      bool
+	// buf holds the HMAC input
+	buf []byte
+	// scratch holds the key or the compared hash
+	scratch []byte
+	sum     []byte
+	hex     []byte
+	// sample, if set, returns the hex encoded HMAC of buf for a token expiring at the time instead of checkSignature
+	// computing it, e.g. from the cache of a CachingValidator
+	sample func(m *macState, expireAt time.Time) []byte
+}
+
+func getMac(h crypto.Hash) *macState {
+	return getMacMode(h, HMAC)
+}
+
+func putMac(h crypto.Hash, m *macState) {
+	putMacMode(h, HMAC, m)
+}
+
+func getMacMode(h crypto.Hash, mode MACMode) *macState {
+	key := macPool{hash: h, mode: mode}
+	pool, ok := macPools.Load(key)
+	if !ok {
+		pool, _ = macPools.LoadOrStore(key, &sync.Pool{
+			New: func() interface{} {
+				if mode == BLAKE2Keyed {
+					return &macState{algorithm: []byte(blake2KeyedTag), blake2: true}
+				}
+
+				inner, outer := h.New(), h.New()
+
+				return &macState{
+					inner:     inner,
+					outer:     outer,
+					ipad:      make([]byte, inner.BlockSize()),
+					opad:      make([]byte, outer.BlockSize()),
+					algorithm: algorithmPrefix(h),
+				}
+			},
+		})
+	}
+
+	return pool.(*sync.Pool).Get().(*macState)
+}
+
+func putMacMode(h crypto.Hash, mode MACMode, m *macState) {
+	m.wipe()
+	pool, _ := macPools.Load(macPool{hash: h, mode: mode})
+	pool.(*sync.Pool).Put(m)
+}
+
+// wipe drops the key material and the MAC input from the state, so the pool doesn't keep them around,
+// e.g. after Manager.Close.
+func (m *macState) wipe() {
+	clear(m.ipad)
+	clear(m.opad)
+	clear(m.buf[:cap(m.buf)])
+	clear(m.scratch[:cap(m.scratch)])
+	clear(m.sum[:cap(m.sum)])
+	clear(m.hex[:cap(m.hex)])
+	// the pads are hashed first, so the hash states are as good as the key
+	if m.inner != nil {
+		m.inner.Reset()
+		m.outer.Reset()
+	}
+	m.keyed, m.keyedSecret = nil, ""
+	m.sample = nil
+}
+
+// algorithmPrefix returns the identifier of the hash covered by the HMAC, so a token generated with one hash can never
+// be valid with another one, even if the validator tries several of them (algorithm agility).
+// The default SHA-512/224 is not identified, to keep the tokens compatible with the ones generated before.
+func algorithmPrefix(h crypto.Hash) []byte {
+	if h == crypto.SHA512_224 {
+		return nil
+	}
+
+	return []byte(h.String() + "|")
+}
+
+// hexSum returns the hex encoded HMAC of buf keyed with the secret.
+// The result is valid until the state is returned to the pool.
+func (m *macState) hexSum(secret string) []byte {
+	m.setKey(secret)
+
+	return m.keyedHexSum()
+}
+
+// setKey prepares the pads for the secret, so several HMACs can be computed with keyedHexSum.
+func (m *macState) setKey(secret string) {
+	if m.blake2 {
+		m.setBLAKE2Key(secret)
+		return
+	}
+
+	for i := range m.ipad {
+		m.ipad[i] = 0
+	}
+	if len(secret) > len(m.ipad) {
+		m.scratch = append(m.scratch[:0], secret...)
+		m.outer.Reset()
+		m.outer.Write(m.scratch)
+		m.sum = m.outer.Sum(m.sum[:0])
+		copy(m.ipad, m.sum)
+	} else {
+		copy(m.ipad, secret)
+	}
+	copy(m.opad, m.ipad)
+	for i := range m.ipad {
+		m.ipad[i] ^= 0x36
+		m.opad[i] ^= 0x5c
+	}
+}
+
+// setBLAKE2Key keys the BLAKE2Keyed hash with the secret, or with its BLAKE2b-512 when it is longer than the maximum
+// key size. The keyed hash is reused as long as the secret doesn't change until the state is returned to the pool.
+func (m *macState) setBLAKE2Key(secret string) {
+	if m.keyed != nil && m.keyedSecret == secret {
+		return
+	}
+
+	key := []byte(secret)
+	if len(key) > blake2b.Size {
+		sum := blake2b.Sum512(key)
+		key = sum[:]
+	}
+	keyed, err := blake2b.New512(key)
+	if err != nil {
+		panic(err)
+	}
+	// the secret may be a view of a buffer wiped later, e.g. by Manager.Close
+	m.keyed, m.keyedSecret = keyed, strings.Clone(secret)
+}
+
+// keyedHexSum works like hexSum, using the key set with setKey.
+func (m *macState) keyedHexSum() []byte {
+	m.keyedSum()
+
+	size := hex.EncodedLen(len(m.sum))
+	if cap(m.hex) < size {
+		m.hex = make([]byte, size)
+	}
+	m.hex = m.hex[:size]
+	hex.Encode(m.hex, m.sum)
+
+	return m.hex
+}
+
+// keyedSum returns the raw HMAC of buf, using the key set with setKey.
+// The result is valid until the state is returned to the pool.
+func (m *macState) keyedSum() []byte {
+	return m.keyedSumOf(m.buf, nil)
+}
+
+// keyedSumOf works like keyedSum for data followed by tag, written straight into the hash instead of copied into buf,
+// e.g. for data of any size.
+func (m *macState) keyedSumOf(data, tag []byte) []byte {
+	if testHookHMAC != nil {
+		testHookHMAC()
+	}
+
+	if m.blake2 {
+		m.keyed.Reset()
+		m.keyed.Write(m.algorithm)
+		m.keyed.Write(data)
+		if len(tag) > 0 {
+			m.keyed.Write(tag)
+		}
+		m.sum = m.keyed.Sum(m.sum[:0])
+
+		return m.sum
+	}
+
+	m.inner.Reset()
+	m.inner.Write(m.ipad)
+	m.inner.Write(m.algorithm)
+	m.inner.Write(data)
+	if len(tag) > 0 {
+		m.inner.Write(tag)
+	}
+	m.sum = m.inner.Sum(m.sum[:0])
+
+	m.outer.Reset()
+	m.outer.Write(m.opad)
+	m.outer.Write(m.sum)
+	m.sum = m.outer.Sum(m.sum[:0])
+
+	return m.sum
+}
@@ -0,0 +1,245 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHmacTokenMatchesStandardHmac(t *testing.T) {
+	contents := tokenContents("user1-login", "1609787986")
+
+	for _, secret := range []string{"", "LoremIpsum123", strings.Repeat("LoremIpsum123", 20)} {
+		for _, h := range []crypto.Hash{crypto.SHA512_224, crypto.SHA256} {
+			expected := hmac.New(h.New, []byte(secret))
+			expected.Write(algorithmPrefix(h))
+			expected.Write([]byte(contents))
+
+			if got := hmacToken(h, contents, secret); got != hex.EncodeToString(expected.Sum(nil)) {
+				t.Errorf("HMAC does not match crypto/hmac for %s and secret of length %d: %s", h, len(secret), got)
+			}
+		}
+	}
+}
+
+func TestValidateTokenDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable under the race detector")
+	}
+
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+
+	valid := testing.AllocsPerRun(100, func() {
+		ValidateToken(token, sessionId, now, secret)
+	})
+	if valid != 0 {
+		t.Errorf("validation of a valid token was expected not to allocate, got %v allocs/op", valid)
+	}
+
+	mismatch := testing.AllocsPerRun(100, func() {
+		ValidateToken(token, "user2-login", now, secret)
+	})
+	if mismatch != 0 {
+		t.Errorf("validation of a mismatched token was expected not to allocate, got %v allocs/op", mismatch)
+	}
+
+	config := &TokenConfig{}
+	configurable := testing.AllocsPerRun(100, func() {
+		config.ValidateToken(token, sessionId, now, secret)
+	})
+	if configurable != 0 {
+		t.Errorf("validation with a config was expected not to allocate, got %v allocs/op", configurable)
+	}
+
+	tokenBytes := []byte(token)
+	fromBytes := testing.AllocsPerRun(100, func() {
+		ValidateTokenBytesToken(tokenBytes, sessionId, now, secret)
+	})
+	if fromBytes != 0 {
+		t.Errorf("validation of a byte slice token was expected not to allocate, got %v allocs/op", fromBytes)
+	}
+}
+
+func BenchmarkValidateToken(b *testing.B) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+
+	b.Run("valid", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ValidateToken(token, sessionId, now, secret)
+		}
+	})
+
+	b.Run("mismatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ValidateToken(token, "user2-login", now, secret)
+		}
+	})
+}
+
+func BenchmarkValidateTokenBytesToken(b *testing.B) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := []byte(GenerateToken(sessionId, now.Add(5*time.Minute), secret))
+
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ValidateTokenBytesToken(token, sessionId, now, secret)
+		}
+	})
+
+	b.Run("string conversion", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ValidateToken(string(token), sessionId, now, secret)
+		}
+	})
+}
+
+func TestTokenMACMatchesHashSegment(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	expireAt := time.Now().Add(time.Minute)
+
+	parsed, err := ParseToken(GenerateToken(sessionId, expireAt, secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mac := TokenMAC(sessionId, expireAt, secret); hex.EncodeToString(mac) != parsed.Hash {
+		t.Errorf("hex encoded MAC was expected to match the hash segment: mac=%x, hash=%s", mac, parsed.Hash)
+	}
+
+	config := &TokenConfig{Hash: crypto.SHA256, Prefix: "appA"}
+	parsed, _ = config.ParseToken(config.GenerateToken(sessionId, expireAt, secret))
+	if mac := config.TokenMAC(sessionId, expireAt, secret); hex.EncodeToString(mac) != parsed.Hash {
+		t.Errorf("hex encoded MAC was expected to match the hash segment of configured token: mac=%x, hash=%s", mac, parsed.Hash)
+	}
+}
+
+func TestBLAKE2KeyedMACMode(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	config := &TokenConfig{MACMode: BLAKE2Keyed}
+
+	token := config.GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+	if !config.ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("BLAKE2Keyed token was expected to be valid")
+	}
+	if config.ValidateToken(token, "user2-login", now, secret) {
+		t.Errorf("BLAKE2Keyed token was expected to be invalid for another session")
+	}
+	if config.ValidateToken(token, sessionId, now, "LoremIpsum124") {
+		t.Errorf("BLAKE2Keyed token was expected to be invalid with another secret")
+	}
+
+	longSecret := strings.Repeat(secret, 10)
+	token = config.GenerateToken(sessionId, now.Add(5*time.Minute), longSecret)
+	if !config.ValidateToken(token, sessionId, now, longSecret) {
+		t.Errorf("BLAKE2Keyed token with a secret longer than the key size was expected to be valid")
+	}
+
+	name, size := config.HashInfo()
+	if name != "BLAKE2b-512 keyed" || size != 64 {
+		t.Errorf("expected BLAKE2b-512 keyed with 64 bytes, got %s with %d", name, size)
+	}
+}
+
+func TestMACModesRejectEachOther(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	keyed := &TokenConfig{MACMode: BLAKE2Keyed}
+	hmacConfigs := map[string]*TokenConfig{
+		"default":     {},
+		"BLAKE2b_512": {Hash: crypto.BLAKE2b_512},
+	}
+
+	for name, config := range hmacConfigs {
+		token := keyed.GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+		if config.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("%s: BLAKE2Keyed token was expected to be rejected by an HMAC config", name)
+		}
+
+		token = config.GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+		if keyed.ValidateToken(token, sessionId, now, secret) {
+			t.Errorf("%s: HMAC token was expected to be rejected by a BLAKE2Keyed config", name)
+		}
+	}
+}
+
+func BenchmarkMACMode(b *testing.B) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	configs := []struct {
+		name   string
+		config *TokenConfig
+	}{
+		{"HMAC", &TokenConfig{}},
+		{"HMAC-BLAKE2b_512", &TokenConfig{Hash: crypto.BLAKE2b_512}},
+		{"BLAKE2Keyed", &TokenConfig{MACMode: BLAKE2Keyed}},
+	}
+
+	for _, c := range configs {
+		token := c.config.GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.config.ValidateToken(token, sessionId, now, secret)
+			}
+		})
+	}
+}
+
+func TestPooledMACStateIsWiped(t *testing.T) {
+	secret := strings.Repeat("LoremIpsum123", 20)
+
+	for _, mode := range []MACMode{HMAC, BLAKE2Keyed} {
+		m := getMacMode(crypto.SHA512_224, mode)
+		m.buf = append(m.buf[:0], "user1-login|1609787986"...)
+		m.setKey(secret)
+		m.keyedHexSum()
+		putMacMode(crypto.SHA512_224, mode, m)
+
+		for _, b := range [][]byte{m.ipad, m.opad, m.buf[:cap(m.buf)], m.scratch[:cap(m.scratch)], m.sum[:cap(m.sum)], m.hex[:cap(m.hex)]} {
+			if strings.Trim(string(b), "\x00") != "" {
+				t.Errorf("pooled state was expected to be wiped in mode %d, got: %x", mode, b)
+			}
+		}
+		if m.keyed != nil || m.keyedSecret != "" {
+			t.Errorf("pooled state was expected to drop the keyed hash in mode %d", mode)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var (
+	// ErrNoSecrets is returned by Manager.SetSecrets when no secrets are given, and SecretRing.GenerateToken panics
+	// with it when no secret is valid.
+	ErrNoSecrets = errors.New("csrf: no secrets")
+	// ErrManagerClosed is returned by Manager.SetSecrets, and Manager.Generate panics with it, after Manager.Close.
+	ErrManagerClosed = errors.New("csrf: manager closed")
+)
+
+// Manager generates and validates tokens with a fixed config, secrets and TTL, so they don't have to be passed around.
+// The secrets can be replaced at runtime with SetSecrets. Manager is safe for concurrent use.
+// Unlike Middleware, Manager doesn't work over a Codec: SetSecrets, PostValidate and Close need the secrets and the
+// parsed HMAC tokens of its TokenConfig. Codec adapts a Manager to the places taking a Codec.
+type Manager struct {
+	// PostValidate, when set, is called for tokens that passed the HMAC and time checks, with the parsed token
+	// and the sessionId. Returning false rejects the token with ReasonRevoked, e.g. when the user logged out after
+	// its issuance.
+	PostValidate func(parsed *ParsedToken, sessionId string) bool
+
+	config *TokenConfig
+	// secrets holds copies of the current secrets, the primary one first, so Close can wipe them
+	secrets atomic.Pointer[[][]byte]
+	// mu is held for reading while the secrets are used, so Close doesn't wipe them under a call in progress
+	mu     sync.RWMutex
+	closed atomic.Bool
+	ttl    time.Duration
+}
+
+// NewManager creates a Manager for the config (nil for the default one) and the secret, issuing tokens valid for ttl.
+// It fails with ErrWeakSecret when the secret is shorter than the config's MinSecretLength.
+func NewManager(config *TokenConfig, secret string, ttl time.Duration) (*Manager, error) {
+	if config == nil {
+		config = defaultConfig
+	}
+
+	m := &Manager{config: config, ttl: ttl}
+	if err := m.SetSecrets([]string{secret}); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SetSecrets atomically replaces the secrets, e.g. when they are reloaded. New tokens are generated with the first
+// (primary) secret, and tokens generated with any of them are valid. Calls in progress keep using the previous secrets.
+// It fails with ErrNoSecrets for an empty list and with ErrWeakSecret when any secret is shorter than the config's MinSecretLength.
+func (m *Manager) SetSecrets(secrets []string) error {
+	if m.closed.Load() {
+		return ErrManagerClosed
+	}
+	if len(secrets) == 0 {
+		return ErrNoSecrets
+	}
+	for _, secret := range secrets {
+		if err := m.config.checkSecret(secret); err != nil {
+			return err
+		}
+	}
+
+	copies := make([][]byte, len(secrets))
+	for i, secret := range secrets {
+		copies[i] = []byte(secret)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Close may have been called since the check above
+	if m.closed.Load() {
+		return ErrManagerClosed
+	}
+	m.secrets.Store(&copies)
+
+	return nil
+}
+
+// Close zeroes the copies of the current secrets held by the Manager, e.g. before discarding a Manager replaced by
+// a new one, and removes the keys the config derived from them with StretchSecret from its cache. The cached keys are
+// immutable strings, so they are only left to the garbage collector, not wiped, and so are the strings given to the
+// Manager and the secrets replaced with SetSecrets. Afterwards, Generate panics with ErrManagerClosed, Validate
+// rejects every token and SetSecrets fails. Close waits for the calls in progress.
+func (m *Manager) Close() {
+	if m.closed.Swap(true) {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	secrets := m.secrets.Swap(nil)
+	for _, secret := range *secrets {
+		m.config.stretched.Delete(secretString(secret))
+		clear(secret)
+	}
+}
+
+// Generate generates a token for the session with the primary secret, expiring after the TTL.
+// It panics with ErrManagerClosed after Close.
+func (m *Manager) Generate(sessionId string) string {
+	return m.generate(sessionId, m.config.now().Add(m.ttl))
+}
+
+// Validate checks if the token is valid for the session now with any of the secrets, and accepted by PostValidate.
+// Every secret is checked, see validateSecrets.
+func (m *Manager) Validate(token, sessionId string) bool {
+	return m.validate(token, sessionId, m.config.now())
+}
+
+// ValidateAndRotate validates the token like Validate and, if it is valid, returns a fresh token for the session,
+// expiring after the TTL, e.g. to rotate the token on every request. It returns false and an empty string otherwise.
+// The fresh token always differs from the validated one: tokens are deterministic, so when it would expire at the same
+// second, it expires a second later instead. The validated token stays valid until its own expiration.
+func (m *Manager) ValidateAndRotate(token, sessionId string) (string, bool) {
+	if !m.Validate(token, sessionId) {
+		return "", false
+	}
+
+	expireAt := m.config.now().Add(m.ttl)
+	rotated := m.generate(sessionId, expireAt)
+	for rotated == token {
+		expireAt = expireAt.Add(time.Second)
+		rotated = m.generate(sessionId, expireAt)
+	}
+
+	return rotated, true
+}
+
+// Codec returns the Codec generating tokens with the primary secret and validating them like Validate, e.g. to use
+// the Manager in Middleware. The expiration date is given by the caller instead of the Manager's TTL.
+func (m *Manager) Codec() Codec {
+	return managerCodec{m: m}
+}
+
+// generate generates a token with the primary secret, panicking with ErrManagerClosed after Close.
+func (m *Manager) generate(sessionId string, expireAt time.Time) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	secrets := m.secrets.Load()
+	if secrets == nil {
+		panic(ErrManagerClosed)
+	}
+
+	return m.config.GenerateToken(sessionId, expireAt, secretString((*secrets)[0]))
+}
+
+func (m *Manager) validate(token, sessionId string, now time.Time) bool {
+	parsed, reason, open := m.validateSecrets(token, sessionId, now)
+	if !open {
+		return false
+	}
+	if reason == "" && m.PostValidate != nil && !m.PostValidate(&parsed, sessionId) {
+		reason = ReasonRevoked
+	}
+	m.config.report(token, sessionId, &parsed, reason)
+
+	return reason == ""
+}
+
+// validateSecrets validates the token with the current secrets. It returns false after Close.
+func (m *Manager) validateSecrets(token, sessionId string, now time.Time) (ParsedToken, string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	secrets := m.secrets.Load()
+	if secrets == nil {
+		return ParsedToken{}, "", false
+	}
+
+	parsed, reason := m.config.validateSecrets(token, sessionId, now, len(*secrets), func(i int) string {
+		return secretString((*secrets)[i])
+	})
+
+	return parsed, reason, true
+}
+
+// secretString returns the secret copy as a string without copying it again, so Close can wipe it.
+func secretString(secret []byte) string {
+	return unsafe.String(unsafe.SliceData(secret), len(secret))
+}
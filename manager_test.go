@@ -0,0 +1,291 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerGenerateValidate(t *testing.T) {
+	m, _ := NewManager(nil, "LoremIpsum123", time.Minute)
+	token := m.Generate("user1-login")
+
+	if !m.Validate(token, "user1-login") {
+		t.Errorf("token was expected to be valid")
+	}
+	if m.Validate(token, "user2-login") {
+		t.Errorf("token was expected to be invalid for other session")
+	}
+	if !ValidateToken(token, "user1-login", time.Now().Add(59*time.Second), "LoremIpsum123") {
+		t.Errorf("token was expected to be valid for the TTL")
+	}
+}
+
+func TestManagerPostValidateVeto(t *testing.T) {
+	metrics := &fakeMetrics{}
+	config := &TokenConfig{IncludeIssuedAt: true, Metrics: metrics}
+	m, _ := NewManager(config, "LoremIpsum123", time.Minute)
+	token := m.Generate("user1-login")
+	loggedOutAt := time.Now().Add(time.Second)
+
+	var called bool
+	m.PostValidate = func(parsed *ParsedToken, sessionId string) bool {
+		called = true
+		return sessionId == "user1-login" && parsed.IssuedAt.After(loggedOutAt)
+	}
+
+	if m.Validate(token, "user1-login") {
+		t.Errorf("token was expected to be vetoed by PostValidate")
+	}
+	if !called {
+		t.Errorf("PostValidate was expected to be called")
+	}
+	if strings.Join(metrics.validated, ",") != ReasonRevoked {
+		t.Errorf("vetoed token was expected to be reported once as revoked, got: %v", metrics.validated)
+	}
+}
+
+func TestManagerPostValidateNotCalledForInvalidToken(t *testing.T) {
+	m, _ := NewManager(nil, "LoremIpsum123", time.Minute)
+	m.PostValidate = func(parsed *ParsedToken, sessionId string) bool {
+		t.Errorf("PostValidate was not expected to be called")
+		return true
+	}
+
+	if m.Validate(GenerateToken("user1-login", time.Now().Add(-time.Second), "LoremIpsum123"), "user1-login") {
+		t.Errorf("expired token was expected to be invalid")
+	}
+}
+
+func TestNewManagerMinSecretLength(t *testing.T) {
+	config := &TokenConfig{MinSecretLength: DefaultMinSecretLength}
+
+	if _, err := NewManager(config, "LoremIpsum123", time.Minute); !errors.Is(err, ErrWeakSecret) {
+		t.Errorf("short secret was expected to be rejected with ErrWeakSecret, got: %v", err)
+	}
+
+	m, err := NewManager(config, strings.Repeat("LoremIpsum123", 3), time.Minute)
+	if err != nil {
+		t.Fatalf("adequate secret was expected to be accepted, got: %s", err)
+	}
+	if !m.Validate(m.Generate("user1-login"), "user1-login") {
+		t.Errorf("token was expected to be valid")
+	}
+
+	if _, err := NewManager(nil, "", time.Minute); err != nil {
+		t.Errorf("secret length was not expected to be checked by default, got: %s", err)
+	}
+}
+
+func TestManagerSetSecrets(t *testing.T) {
+	m, _ := NewManager(nil, "LoremIpsum123", time.Minute)
+	oldToken := m.Generate("user1-login")
+
+	if err := m.SetSecrets([]string{"DolorSitAmet456", "LoremIpsum123"}); err != nil {
+		t.Fatal(err)
+	}
+	newToken := m.Generate("user1-login")
+
+	if !ValidateToken(newToken, "user1-login", time.Now(), "DolorSitAmet456") {
+		t.Errorf("new token was expected to be generated with the new primary secret")
+	}
+	if !m.Validate(oldToken, "user1-login") || !m.Validate(newToken, "user1-login") {
+		t.Errorf("tokens of both secrets were expected to be valid during the overlap")
+	}
+
+	m.SetSecrets([]string{"DolorSitAmet456"})
+	if m.Validate(oldToken, "user1-login") {
+		t.Errorf("token of the removed secret was expected to be invalid")
+	}
+}
+
+func TestManagerSetSecretsRejectsInvalidSecrets(t *testing.T) {
+	m, _ := NewManager(&TokenConfig{MinSecretLength: 10}, "LoremIpsum123", time.Minute)
+
+	if err := m.SetSecrets(nil); err != ErrNoSecrets {
+		t.Errorf("empty secrets were expected to be rejected")
+	}
+	if err := m.SetSecrets([]string{"LoremIpsum123", "short"}); !errors.Is(err, ErrWeakSecret) {
+		t.Errorf("short secret was expected to be rejected with ErrWeakSecret, got: %v", err)
+	}
+	if !m.Validate(m.Generate("user1-login"), "user1-login") {
+		t.Errorf("rejected secrets were not expected to replace the current ones")
+	}
+}
+
+func TestManagerSetSecretsConcurrently(t *testing.T) {
+	m, _ := NewManager(nil, "LoremIpsum123", time.Minute)
+	rings := [][]string{
+		{"LoremIpsum123", "DolorSitAmet456"},
+		{"DolorSitAmet456", "LoremIpsum123"},
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// both secrets are in every ring, so tokens stay valid across the swaps
+				if token := m.Generate("user1-login"); !m.Validate(token, "user1-login") {
+					t.Errorf("token was expected to remain valid across the swap: %s", token)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		m.SetSecrets(rings[i%2])
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestManagerValidateAndRotate(t *testing.T) {
+	clock := &FixedClock{Time: time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)}
+	m, err := NewManager(&TokenConfig{Clock: clock}, "LoremIpsum123", 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := m.Generate("user1-login")
+
+	clock.Time = clock.Time.Add(time.Minute)
+	rotated, ok := m.ValidateAndRotate(token, "user1-login")
+	if !ok || rotated == "" || rotated == token {
+		t.Fatalf("valid token was expected to be rotated to a fresh one: token=%s, rotated=%s", token, rotated)
+	}
+	if !m.Validate(rotated, "user1-login") {
+		t.Errorf("rotated token was expected to be valid")
+	}
+	if expiry, _ := TokenExpiry(rotated); !expiry.Equal(clock.Time.Add(10 * time.Minute)) {
+		t.Errorf("rotated token was expected to expire after the TTL, got: %s", expiry)
+	}
+
+	if rotated, ok := m.ValidateAndRotate(token, "user2-login"); ok || rotated != "" {
+		t.Errorf("invalid token was not expected to be rotated, got: %s", rotated)
+	}
+
+	// generated at the same second, the fresh token would be the same as the validated one
+	same, ok := m.ValidateAndRotate(rotated, "user1-login")
+	if !ok || same == rotated {
+		t.Fatalf("token rotated at the same second was expected to differ: token=%s, rotated=%s", rotated, same)
+	}
+	if expiry, _ := TokenExpiry(same); !expiry.Equal(clock.Time.Add(10*time.Minute + time.Second)) {
+		t.Errorf("token rotated at the same second was expected to expire a second later, got: %s", expiry)
+	}
+}
+
+func TestManagerClose(t *testing.T) {
+	config := &TokenConfig{StretchSecret: true, StretchIterations: 1000}
+	m, err := NewManager(config, "LoremIpsum123", 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := m.Generate("user1-login")
+	secret := (*m.secrets.Load())[0]
+
+	m.Close()
+
+	for i, b := range secret {
+		if b != 0 {
+			t.Fatalf("secret was expected to be zeroed, got %q at %d", b, i)
+		}
+	}
+	if _, ok := config.stretched.Load("LoremIpsum123"); ok {
+		t.Errorf("stretched key was expected to be dropped")
+	}
+	if m.Validate(token, "user1-login") {
+		t.Errorf("closed manager was expected to reject every token")
+	}
+	if err := m.SetSecrets([]string{"LoremIpsum123"}); !errors.Is(err, ErrManagerClosed) {
+		t.Errorf("ErrManagerClosed was expected, got: %v", err)
+	}
+	m.Close()
+
+	defer func() {
+		if r := recover(); r != ErrManagerClosed {
+			t.Errorf("Generate was expected to panic with ErrManagerClosed, got: %v", r)
+		}
+	}()
+	m.Generate("user1-login")
+}
+
+func TestManagerCloseWaitsForCallsInProgress(t *testing.T) {
+	m, _ := NewManager(nil, "LoremIpsum123", time.Minute)
+	token := m.Generate("user1-login")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Validate(token, "user1-login")
+				m.Codec().Validate(token, "user1-login", time.Now())
+			}
+		}()
+	}
+	m.Close()
+	wg.Wait()
+
+	if m.Validate(token, "user1-login") {
+		t.Errorf("closed manager was expected to reject every token")
+	}
+}
+
+func TestManagerReportsOnce(t *testing.T) {
+	sessionId := "user1-login"
+	metrics := &fakeMetrics{}
+	var logged []any
+	config := &TokenConfig{Metrics: metrics, Logger: func(msg string, fields map[string]any) {
+		logged = append(logged, fields["reason"])
+	}}
+	m, err := NewManager(config, "LoremIpsum123", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := m.Generate(sessionId)
+	if err := m.SetSecrets([]string{"DolorSitAmet456", "LoremIpsum123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Validate(token, sessionId) {
+		t.Errorf("token generated with the previous secret was expected to be valid")
+	}
+	m.Validate(token, "user2-login")
+
+	if got := strings.Join(metrics.validated, ","); got != "valid,mismatch" {
+		t.Errorf("every validation was expected to be reported once, got: %s", got)
+	}
+	if len(logged) != 1 || logged[0] != ReasonMismatch {
+		t.Errorf("only the rejected validation was expected to be logged, got: %v", logged)
+	}
+}
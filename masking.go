@@ -0,0 +1,82 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrMalformedMaskedToken is returned by UnmaskToken when the masked token cannot be decoded.
+var ErrMalformedMaskedToken = errors.New("csrf: malformed masked token")
+
+// GenerateMaskedToken generates a token like GenerateToken and masks it with a random one-time pad,
+// so the value changes with every call even for the same arguments (mitigates BREACH attacks).
+// Masked tokens have to be unmasked with UnmaskToken or validated with ValidateMaskedToken.
+// GenerateToken with the same arguments returns the canonical, unmasked token, which is stable between calls.
+func GenerateMaskedToken(sessionId string, expireAt time.Time, secret string) (string, error) {
+	return GenerateMaskedTokenFrom(rand.Reader, sessionId, expireAt, secret)
+}
+
+// GenerateMaskedTokenFrom works like GenerateMaskedToken, but reads the one-time pad from the given source.
+// The source should be cryptographically secure, e.g. an approved RNG - a predictable source is only suitable for tests.
+func GenerateMaskedTokenFrom(rand io.Reader, sessionId string, expireAt time.Time, secret string) (string, error) {
+	token := []byte(GenerateToken(sessionId, expireAt, secret))
+
+	masked := make([]byte, 2*len(token))
+	pad := masked[:len(token)]
+	if _, err := io.ReadFull(rand, pad); err != nil {
+		return "", err
+	}
+	for i := range token {
+		masked[len(token)+i] = token[i] ^ pad[i]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(masked), nil
+}
+
+// UnmaskToken reverts the masking applied by GenerateMaskedToken and returns the original token.
+func UnmaskToken(masked string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(masked)
+	if err != nil || len(raw) == 0 || len(raw)%2 != 0 {
+		return "", ErrMalformedMaskedToken
+	}
+
+	size := len(raw) / 2
+	token := make([]byte, size)
+	for i := range token {
+		token[i] = raw[i] ^ raw[size+i]
+	}
+
+	return string(token), nil
+}
+
+// ValidateMaskedToken unmasks the token and checks it with ValidateToken.
+func ValidateMaskedToken(masked, sessionId string, now time.Time, secret string) bool {
+	token, err := UnmaskToken(masked)
+	if err != nil {
+		return false
+	}
+
+	return ValidateToken(token, sessionId, now, secret)
+}
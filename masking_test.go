@@ -0,0 +1,119 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestValidMaskedTokenFlow(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	masked, err := GenerateMaskedToken(sessionId, expireAt, secret)
+	if err != nil {
+		t.Fatalf("masked token generation failed: %s", err)
+	}
+
+	if !ValidateMaskedToken(masked, sessionId, now, secret) {
+		t.Errorf("masked token validation failed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", masked, sessionId, expireAt, secret, now)
+	}
+}
+
+func TestMaskedTokensDifferBetweenCalls(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	expireAt := time.Now().Add(5 * time.Minute)
+
+	first, _ := GenerateMaskedToken(sessionId, expireAt, secret)
+	second, _ := GenerateMaskedToken(sessionId, expireAt, secret)
+
+	if first == second {
+		t.Errorf("masked tokens were expected to differ: first=%s, second=%s", first, second)
+	}
+}
+
+func TestCanonicalTokenIsStableWhileMaskedVaries(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	expireAt := time.Now().Add(5 * time.Minute)
+
+	canonical := GenerateToken(sessionId, expireAt, secret)
+	if again := GenerateToken(sessionId, expireAt, secret); again != canonical {
+		t.Errorf("canonical tokens were expected to be equal: first=%s, second=%s", canonical, again)
+	}
+
+	first, _ := GenerateMaskedToken(sessionId, expireAt, secret)
+	second, _ := GenerateMaskedToken(sessionId, expireAt, secret)
+	if first == second {
+		t.Errorf("masked tokens were expected to differ: first=%s, second=%s", first, second)
+	}
+
+	for _, masked := range []string{first, second} {
+		if unmasked, _ := UnmaskToken(masked); unmasked != canonical {
+			t.Errorf("masked token was expected to unmask to the canonical token: canonical=%s, unmasked=%s", canonical, unmasked)
+		}
+	}
+}
+
+func TestMaskedTokenFromFixedSourceIsPredictable(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+	pad := bytes.Repeat([]byte{0x2a}, 128)
+
+	first, err := GenerateMaskedTokenFrom(bytes.NewReader(pad), sessionId, expireAt, secret)
+	if err != nil {
+		t.Fatalf("masked token generation failed: %s", err)
+	}
+	second, _ := GenerateMaskedTokenFrom(bytes.NewReader(pad), sessionId, expireAt, secret)
+
+	if first != second {
+		t.Errorf("masked tokens from the same source were expected to be equal: first=%s, second=%s", first, second)
+	}
+
+	token, err := UnmaskToken(first)
+	if err != nil || token != GenerateToken(sessionId, expireAt, secret) {
+		t.Errorf("unmasked token does not match the original: token=%s, err=%v", token, err)
+	}
+
+	if !ValidateMaskedToken(first, sessionId, now, secret) {
+		t.Errorf("masked token validation failed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", first, sessionId, expireAt, secret, now)
+	}
+}
+
+func TestMaskedTokenFromShortSourceFails(t *testing.T) {
+	_, err := GenerateMaskedTokenFrom(bytes.NewReader([]byte{0x2a}), "user1-login", time.Now(), "LoremIpsum123")
+
+	if err == nil {
+		t.Errorf("masked token generation was expected to fail for a short source")
+	}
+}
+
+func TestMalformedMaskedTokenIsInvalid(t *testing.T) {
+	if ValidateMaskedToken("lorem.ipsum", "user1-login", time.Now(), "LoremIpsum123") {
+		t.Errorf("malformed masked token validation was expected to fail, but passed")
+	}
+}
@@ -0,0 +1,51 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+// Validation failure reasons reported to Metrics.
+const (
+	ReasonMalformed          = "malformed"
+	ReasonUnsupportedVersion = "unsupported_version"
+	ReasonExpired            = "expired"
+	ReasonIssuedInFuture     = "issued_in_future"
+	ReasonTooOld             = "too_old"
+	ReasonMismatch           = "mismatch"
+	ReasonEmptySecret        = "empty_secret"
+	// ReasonRevoked is reported for a valid token rejected afterwards, by ValidateTokenWithRevocation or
+	// Manager.PostValidate.
+	ReasonRevoked = "revoked"
+	// ReasonWrongAudience is reported for a valid token of ValidateTokenAud without the required audience.
+	ReasonWrongAudience = "wrong_audience"
+)
+
+// Metrics receives counters from token generation and validation, e.g. to export them to Prometheus.
+type Metrics interface {
+	// IncGenerated is called for every generated token.
+	IncGenerated()
+	// IncValidated is called for every validated token, reason is empty for valid tokens and one of the Reason
+	// constants otherwise.
+	IncValidated(valid bool, reason string)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncGenerated() {}
+
+func (noopMetrics) IncValidated(bool, string) {}
@@ -0,0 +1,71 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeMetrics struct {
+	generated int
+	validated []string
+}
+
+func (m *fakeMetrics) IncGenerated() {
+	m.generated++
+}
+
+func (m *fakeMetrics) IncValidated(valid bool, reason string) {
+	if valid {
+		reason = "valid"
+	}
+	m.validated = append(m.validated, reason)
+}
+
+func TestMetricsAreNotified(t *testing.T) {
+	metrics := &fakeMetrics{}
+	config := &TokenConfig{Metrics: metrics}
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	token := config.GenerateToken(sessionId, now.Add(5*time.Minute), secret)
+	expiredToken := config.GenerateToken(sessionId, now.Add(-5*time.Minute), secret)
+
+	config.ValidateToken(token, sessionId, now, secret)
+	config.ValidateToken(expiredToken, sessionId, now, secret)
+	config.ValidateToken(token, "user2-login", now, secret)
+	config.ValidateToken("loremipsum", sessionId, now, secret)
+
+	if metrics.generated != 2 {
+		t.Errorf("2 generated tokens were expected, got: %d", metrics.generated)
+	}
+
+	expected := []string{"valid", ReasonExpired, ReasonMismatch, ReasonMalformed}
+	if len(metrics.validated) != len(expected) {
+		t.Fatalf("unexpected validations: %v", metrics.validated)
+	}
+	for i := range expected {
+		if metrics.validated[i] != expected[i] {
+			t.Errorf("unexpected validation reason: expected=%s, got=%s", expected[i], metrics.validated[i])
+		}
+	}
+}
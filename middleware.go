@@ -0,0 +1,324 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxMultipartPrefix limits how much of a multipart body is read while looking for the token.
+const maxMultipartPrefix = 1 << 20
+
+// maxJSONBody limits the size of JSON bodies the token is read from, larger ones are rejected.
+const maxJSONBody = 1 << 20
+
+type contextKey struct{}
+
+// MiddlewareConfig configures the HTTP middleware returned by Middleware.
+type MiddlewareConfig struct {
+	// Config is used to generate and validate the tokens, the zero TokenConfig by default.
+	Config *TokenConfig
+	// Secret is used to generate and validate the tokens.
+	Secret string
+	// Codec generates and validates the tokens instead of Config and Secret, e.g. Manager.Codec or a Codec with
+	// a different token scheme. An HMACCodec with Config and Secret by default.
+	Codec Codec
+	// TTL is the lifetime of issued tokens, one hour by default.
+	TTL time.Duration
+	// SessionId returns the sessionId of the request, see GenerateToken for details.
+	SessionId func(r *http.Request) string
+	// HeaderName is the request header carrying the token, "X-CSRF-Token" by default.
+	HeaderName string
+	// AuthScheme, when set, also reads the token from the Authorization header with this scheme, e.g. "CSRF" for
+	// "Authorization: CSRF <token>", when the HeaderName header is empty. Other schemes are ignored. Not read by default.
+	AuthScheme string
+	// FieldName is the form field carrying the token, used when the header is empty, "csrf_token" by default.
+	// In multipart forms, the field must precede all file parts.
+	FieldName string
+	// Cookie configures the cookie the issued token is stored in.
+	Cookie CookieOptions
+	// TokenResponseHeader, when set, is the response header the issued token is also written to, e.g. "X-CSRF-Token"
+	// for clients that can't read cookies. Not written by default.
+	TokenResponseHeader string
+	// NoCookie doesn't store the issued token in a cookie, e.g. when clients read it from the TokenResponseHeader.
+	NoCookie bool
+	// CacheControl is set on responses issuing a token, so shared caches don't serve one user's token to another.
+	// "no-store" by default.
+	CacheControl string
+	// Skip lets the request through without validating or issuing a token when it returns true,
+	// e.g. for webhooks verified by their own signatures. Nothing is skipped by default.
+	Skip func(r *http.Request) bool
+	// TrustedOrigins lists the origins (e.g. "https://example.com") allowed to send unsafe requests.
+	// The Origin header is checked, or the origin of the Referer when Origin is missing. Requests with neither are
+	// checked only by the token. Origins are not checked when the list is empty, which is the default.
+	TrustedOrigins []string
+	// TokenFromJSON reads the token from the JSONField of application/json request bodies, when the header is empty.
+	// The body is restored, so the handler can still read it. Bodies that are not valid JSON objects or are larger
+	// than 1 MiB are rejected. Disabled by default.
+	TokenFromJSON bool
+	// JSONField is the path of the JSON field carrying the token, with nested fields separated by dots, e.g.
+	// "meta.csrf_token". FieldName by default.
+	JSONField string
+	// BindRoute requires unsafe requests to carry a token bound to their method and path, generated with
+	// GenerateTokenRoute (or the Codec, for the sessionId returned by RouteSessionId). Tokens issued on safe requests
+	// are not bound to any route, so the handler has to generate route tokens itself. Disabled by default.
+	BindRoute bool
+	// BindUserAgent binds issued and validated tokens to the SHA-256 of the User-Agent header, so a token replayed
+	// from another browser is rejected. Tokens generated by the handler must use the sessionId returned by
+	// UserAgentSessionId. Disabled by default.
+	BindUserAgent bool
+	// RotateOnValidate issues a fresh token, like on safe requests, after every successfully validated unsafe request,
+	// so the client gets a new expiration date, e.g. to keep a long-lived form usable. The validated token stays valid
+	// until its own expiration, and it is the same as the fresh one if both expire at the same second. If the handler
+	// issues a token cookie too, the last one written wins. Disabled by default.
+	RotateOnValidate bool
+}
+
+// Middleware returns HTTP middleware protecting the handler against CSRF.
+// Requests with safe methods (GET, HEAD, OPTIONS, TRACE) are issued a fresh token, available via TokenFromContext,
+// the cookie and the TokenResponseHeader. Other requests must send a valid token in the HeaderName header or the FieldName form field,
+// otherwise they are rejected with 403 Forbidden.
+func Middleware(config MiddlewareConfig) func(http.Handler) http.Handler {
+	if config.Config == nil {
+		config.Config = defaultConfig
+	}
+	if config.Codec == nil {
+		config.Codec = &HMACCodec{Config: config.Config, Secret: config.Secret}
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Hour
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	if config.FieldName == "" {
+		config.FieldName = "csrf_token"
+	}
+	if config.JSONField == "" {
+		config.JSONField = config.FieldName
+	}
+	if config.CacheControl == "" {
+		config.CacheControl = "no-store"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.Skip != nil && config.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sessionId := config.SessionId(r)
+			if config.BindUserAgent {
+				sessionId = UserAgentSessionId(sessionId, r.UserAgent())
+			}
+
+			if isSafeMethod(r.Method) {
+				config.issueToken(w, r, sessionId, next)
+				return
+			}
+
+			if !config.originTrusted(r) {
+				http.Error(w, "untrusted origin", http.StatusForbidden)
+				return
+			}
+
+			validatedSession := sessionId
+			if config.BindRoute {
+				validatedSession = RouteSessionId(sessionId, r.Method, r.URL.Path)
+			}
+			if !config.Codec.Validate(config.requestToken(r), validatedSession, config.Config.now()) {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+
+			if config.RotateOnValidate {
+				config.issueToken(w, r, sessionId, next)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// issueToken sets a fresh token cookie (and TokenResponseHeader) and passes the request, with the token in its context,
+// to the next handler.
+func (config *MiddlewareConfig) issueToken(w http.ResponseWriter, r *http.Request, sessionId string, next http.Handler) {
+	expireAt := config.Config.now().Add(config.TTL)
+	token := config.Codec.Generate(sessionId, expireAt)
+
+	if !config.NoCookie {
+		if err := SetTokenCookie(w, token, expireAt, config.Cookie); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if config.TokenResponseHeader != "" {
+		w.Header().Set(config.TokenResponseHeader, token)
+	}
+	w.Header().Set("Cache-Control", config.CacheControl)
+	w.Header().Add("Vary", "Cookie")
+
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, token)))
+}
+
+// TokenFromContext returns the token issued by the middleware for the request, or an empty string.
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(contextKey{}).(string)
+
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// originTrusted reports whether the Origin (or Referer) of the request is one of TrustedOrigins.
+func (config *MiddlewareConfig) originTrusted(r *http.Request) bool {
+	if len(config.TrustedOrigins) == 0 {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+
+		u, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	for _, trusted := range config.TrustedOrigins {
+		if strings.EqualFold(origin, trusted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (config *MiddlewareConfig) requestToken(r *http.Request) string {
+	if token := r.Header.Get(config.HeaderName); token != "" {
+		return token
+	}
+	if token := config.authorizationToken(r); token != "" {
+		return token
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return config.multipartToken(r)
+	}
+	if mediaType == "application/json" && config.TokenFromJSON {
+		return config.jsonToken(r)
+	}
+
+	return r.PostFormValue(config.FieldName)
+}
+
+// authorizationToken returns the credentials of the Authorization header with the AuthScheme, the scheme is matched
+// case-insensitively.
+func (config *MiddlewareConfig) authorizationToken(r *http.Request) string {
+	if config.AuthScheme == "" {
+		return ""
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, config.AuthScheme) {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// multipartToken reads the token field preceding any file part of the multipart form,
+// without parsing the whole form. The body is restored, so the handler can still read the whole form, files included.
+func (config *MiddlewareConfig) multipartToken(r *http.Request) string {
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	body := r.Body
+	var consumed bytes.Buffer
+	defer func() {
+		r.Body = readCloser{Reader: io.MultiReader(&consumed, body), Closer: body}
+	}()
+
+	mr := multipart.NewReader(io.TeeReader(io.LimitReader(body, maxMultipartPrefix), &consumed), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil || part.FileName() != "" {
+			return ""
+		}
+
+		if part.FormName() == config.FieldName {
+			token, _ := io.ReadAll(io.LimitReader(part, 4096))
+			return string(token)
+		}
+	}
+}
+
+// jsonToken reads the token from the JSONField of the JSON body. The body is restored, so the handler can still read it.
+func (config *MiddlewareConfig) jsonToken(r *http.Request) string {
+	body := r.Body
+	consumed, err := io.ReadAll(io.LimitReader(body, maxJSONBody+1))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(consumed), body), Closer: body}
+	if err != nil || len(consumed) > maxJSONBody {
+		return ""
+	}
+
+	var value any
+	if err := json.Unmarshal(consumed, &value); err != nil {
+		return ""
+	}
+	for _, field := range strings.Split(config.JSONField, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = object[field]
+	}
+	token, _ := value.(string)
+
+	return token
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
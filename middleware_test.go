@@ -0,0 +1,526 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMiddlewareConfig() MiddlewareConfig {
+	return MiddlewareConfig{
+		Secret: "LoremIpsum123",
+		SessionId: func(r *http.Request) string {
+			return "user1-login"
+		},
+	}
+}
+
+func serveMiddleware(config MiddlewareConfig, r *http.Request) (*httptest.ResponseRecorder, string) {
+	var token string
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = TokenFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w, token
+}
+
+func TestMiddlewareIssuesTokenOnSafeRequest(t *testing.T) {
+	w, token := serveMiddleware(testMiddlewareConfig(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !ValidateToken(token, "user1-login", time.Now(), "LoremIpsum123") {
+		t.Errorf("issued token is invalid: token=%s", token)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || cookies[0].Value != token {
+		t.Errorf("token cookie was expected, got: %v", cookies)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control was expected to be no-store, got: %s", cc)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Cookie" {
+		t.Errorf("Vary was expected to be Cookie, got: %s", vary)
+	}
+}
+
+func TestMiddlewareUsesConfiguredCacheControl(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.CacheControl = "private, no-cache"
+
+	w, _ := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if cc := w.Header().Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("Cache-Control was expected to be private, no-cache, got: %s", cc)
+	}
+}
+
+func TestMiddlewareAcceptsValidTokenInHeader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+
+	w, _ := serveMiddleware(testMiddlewareConfig(), r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "" {
+		t.Errorf("Cache-Control was not expected on a response without a token, got: %s", cc)
+	}
+	if vary := w.Header().Get("Vary"); vary != "" {
+		t.Errorf("Vary was not expected on a response without a token, got: %s", vary)
+	}
+}
+
+func TestMiddlewareAcceptsValidTokenInForm(t *testing.T) {
+	form := url.Values{"csrf_token": {GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")}}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w, _ := serveMiddleware(testMiddlewareConfig(), r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareRejectsMissingToken(t *testing.T) {
+	w, _ := serveMiddleware(testMiddlewareConfig(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("request was expected to be rejected, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareRejectsInvalidToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", GenerateToken("user2-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+
+	w, _ := serveMiddleware(testMiddlewareConfig(), r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("request was expected to be rejected, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareFailsWithInsecureSameSiteNoneCookie(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.Cookie = CookieOptions{SameSite: http.SameSiteNoneMode}
+
+	w, _ := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("request was expected to fail, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareAcceptsTokenInCustomHeader(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.HeaderName = "X-XSRF-TOKEN"
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-XSRF-TOKEN", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareAcceptsTokenInCustomField(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.FieldName = "_token"
+	form := url.Values{"_token": {GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")}}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewarePrefersHeaderOverField(t *testing.T) {
+	form := url.Values{"csrf_token": {GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")}}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-CSRF-Token", "loremipsum")
+
+	if w, _ := serveMiddleware(testMiddlewareConfig(), r); w.Code != http.StatusForbidden {
+		t.Errorf("invalid header token was expected to take precedence, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareRejectsTokenUnderDefaultNamesWhenCustomized(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.HeaderName = "X-XSRF-TOKEN"
+	config.FieldName = "_token"
+	form := url.Values{"csrf_token": {GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")}}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-CSRF-Token", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+		t.Errorf("request without the token under configured names was expected to be rejected, got status: %d", w.Code)
+	}
+}
+
+func multipartRequest(t *testing.T, fileFirst bool, token string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	writeFile := func() {
+		fw, err := mw.CreateFormFile("upload", "lorem.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(bytes.Repeat([]byte("lorem ipsum "), 1000))
+	}
+
+	if fileFirst {
+		writeFile()
+	}
+	mw.WriteField("csrf_token", token)
+	if !fileFirst {
+		writeFile()
+	}
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return r
+}
+
+func TestMiddlewareReadsTokenFromMultipartForm(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+	var uploaded []byte
+	handler := Middleware(testMiddlewareConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("upload")
+		if err != nil {
+			t.Fatalf("file was expected to be readable downstream: %s", err)
+		}
+		uploaded, _ = io.ReadAll(file)
+		if r.FormValue("csrf_token") != token {
+			t.Errorf("token field was expected to be readable downstream")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, multipartRequest(t, false, token))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", w.Code)
+	}
+	if !bytes.Equal(uploaded, bytes.Repeat([]byte("lorem ipsum "), 1000)) {
+		t.Errorf("uploaded file was expected to be intact, got %d bytes", len(uploaded))
+	}
+}
+
+func TestMiddlewareRejectsMultipartTokenAfterFile(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+
+	if w, _ := serveMiddleware(testMiddlewareConfig(), multipartRequest(t, true, token)); w.Code != http.StatusForbidden {
+		t.Errorf("token after file part was expected to be rejected, got status: %d", w.Code)
+	}
+}
+
+func jsonRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	return r
+}
+
+func TestMiddlewareReadsTokenFromJSON(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+	body := `{"csrf_token": "` + token + `", "approve": [1, 2, 3]}`
+	config := testMiddlewareConfig()
+	config.TokenFromJSON = true
+
+	var received []byte
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, jsonRequest(body))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("request was expected to pass, got status: %d", w.Code)
+	}
+	if string(received) != body {
+		t.Errorf("handler was expected to receive the whole body, got: %s", received)
+	}
+}
+
+func TestMiddlewareRejectsInvalidTokenFromJSON(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+	config := testMiddlewareConfig()
+	config.TokenFromJSON = true
+
+	for _, body := range []string{
+		`{"csrf_token": "` + GenerateToken("user2-login", time.Now().Add(time.Minute), "LoremIpsum123") + `"}`,
+		`{"csrf_token": 123}`,
+		`{"csrf_token": "` + token + `"`,
+		`["` + token + `"]`,
+		`{}`,
+	} {
+		if w, _ := serveMiddleware(config, jsonRequest(body)); w.Code != http.StatusForbidden {
+			t.Errorf("request was expected to be rejected, got status: %d, body: %s", w.Code, body)
+		}
+	}
+
+	config.TokenFromJSON = false
+	if w, _ := serveMiddleware(config, jsonRequest(`{"csrf_token": "`+token+`"}`)); w.Code != http.StatusForbidden {
+		t.Errorf("token in JSON was not expected to be read by default, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareReadsTokenFromNestedJSONField(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+	config := testMiddlewareConfig()
+	config.TokenFromJSON = true
+	config.JSONField = "meta.csrf"
+
+	if w, _ := serveMiddleware(config, jsonRequest(`{"meta": {"csrf": "`+token+`"}}`)); w.Code != http.StatusOK {
+		t.Errorf("token in the nested field was expected to pass, got status: %d", w.Code)
+	}
+	if w, _ := serveMiddleware(config, jsonRequest(`{"csrf_token": "`+token+`"}`)); w.Code != http.StatusForbidden {
+		t.Errorf("token outside the configured field was expected to be rejected, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareRejectsOversizedTokenBeforeHMAC(t *testing.T) {
+	var computed int
+	testHookHMAC = func() { computed++ }
+	defer func() { testHookHMAC = nil }()
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", strings.Repeat("a", 1<<20))
+
+	if w, _ := serveMiddleware(testMiddlewareConfig(), r); w.Code != http.StatusForbidden {
+		t.Errorf("oversized token was expected to be rejected, got status: %d", w.Code)
+	}
+	if computed != 0 {
+		t.Errorf("HMAC of the oversized token was not expected to be computed, computed: %d", computed)
+	}
+}
+
+func TestMiddlewareReadsTokenFromAuthorization(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+	config := testMiddlewareConfig()
+	config.AuthScheme = "CSRF"
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "CSRF "+token)
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusOK {
+		t.Errorf("token in the Authorization header was expected to pass, got status: %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+		t.Errorf("token with another scheme was expected to be ignored, got status: %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer abc")
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusOK {
+		t.Errorf("request with another scheme was expected to fall through to the form, got status: %d", w.Code)
+	}
+
+	for _, header := range []string{"CSRF", "CSRF ", " CSRF", "csrf" + token} {
+		r = httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("Authorization", header)
+		if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+			t.Errorf("malformed Authorization header %q was expected to be rejected, got status: %d", header, w.Code)
+		}
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "CSRF "+token)
+	if w, _ := serveMiddleware(testMiddlewareConfig(), r); w.Code != http.StatusForbidden {
+		t.Errorf("Authorization header was not expected to be read by default, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareSkip(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.Skip = func(r *http.Request) bool {
+		return r.URL.Path == "/webhook"
+	}
+
+	if w, _ := serveMiddleware(config, httptest.NewRequest(http.MethodPost, "/webhook", nil)); w.Code != http.StatusOK {
+		t.Errorf("skipped path was expected to pass without a token, got status: %d", w.Code)
+	}
+	if w, _ := serveMiddleware(config, httptest.NewRequest(http.MethodPost, "/form", nil)); w.Code != http.StatusForbidden {
+		t.Errorf("path that is not skipped was expected to be rejected, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareSkipDoesNotIssueToken(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.Skip = func(r *http.Request) bool {
+		return true
+	}
+
+	w, token := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/webhook", nil))
+
+	if token != "" || w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("skipped request was expected not to be issued a token, got: %q", token)
+	}
+}
+
+func TestMiddlewareTrustedOrigins(t *testing.T) {
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+	config := testMiddlewareConfig()
+	config.TrustedOrigins = []string{"https://example.com"}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"allowed origin", map[string]string{"Origin": "https://example.com"}, http.StatusOK},
+		{"disallowed origin", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"null origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"allowed referer", map[string]string{"Referer": "https://example.com/form?x=1"}, http.StatusOK},
+		{"disallowed referer", map[string]string{"Referer": "https://evil.example/form"}, http.StatusForbidden},
+		{"origin takes precedence", map[string]string{"Origin": "https://evil.example", "Referer": "https://example.com/"}, http.StatusForbidden},
+		{"missing both", nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("X-CSRF-Token", token)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+
+		if w, _ := serveMiddleware(config, r); w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got: %d", tt.name, tt.status, w.Code)
+		}
+	}
+}
+
+func TestMiddlewareTrustedOriginsStillRequireToken(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.TrustedOrigins = []string{"https://example.com"}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+		t.Errorf("request from trusted origin without token was expected to be rejected, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareRotateOnValidate(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.RotateOnValidate = true
+	token := GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123")
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", token)
+	w, rotated := serveMiddleware(config, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("request was expected to pass, got status: %d", w.Code)
+	}
+	if rotated == "" || rotated == token {
+		t.Errorf("a new token was expected in the context, got: %q", rotated)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != rotated {
+		t.Errorf("new token was expected in the cookie, got: %v", cookies)
+	}
+	if !ValidateToken(rotated, "user1-login", time.Now(), "LoremIpsum123") {
+		t.Errorf("rotated token was expected to be valid")
+	}
+}
+
+func TestMiddlewareDoesNotRotateByDefault(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+	w, token := serveMiddleware(testMiddlewareConfig(), r)
+
+	if token != "" || len(w.Result().Cookies()) != 0 {
+		t.Errorf("no token was expected to be issued, got: %q", token)
+	}
+}
+
+func TestMiddlewareRotateOnValidateHandlerCookieWins(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.RotateOnValidate = true
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetTokenCookie(w, "issued-by-handler", time.Now().Add(time.Minute), CookieOptions{})
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 || cookies[len(cookies)-1].Value != "issued-by-handler" {
+		t.Errorf("cookie written by the handler was expected to be the last one, got: %v", cookies)
+	}
+}
+
+func TestMiddlewareTokenResponseHeader(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.TokenResponseHeader = "X-CSRF-Token"
+
+	w, token := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/", nil))
+	if header := w.Header().Get("X-CSRF-Token"); header == "" || header != token {
+		t.Fatalf("issued token was expected in the response header, got: %q", header)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != token {
+		t.Errorf("token cookie was expected too, got: %v", cookies)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", w.Header().Get("X-CSRF-Token"))
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusOK {
+		t.Errorf("request echoing the token from the response header was expected to pass, got status: %d", w.Code)
+	}
+}
+
+func TestMiddlewareNoCookie(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.TokenResponseHeader = "X-CSRF-Token"
+	config.NoCookie = true
+
+	w, token := serveMiddleware(config, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Header().Get("X-CSRF-Token") != token {
+		t.Errorf("issued token was expected in the response header, got: %q", w.Header().Get("X-CSRF-Token"))
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("no cookie was expected, got: %v", cookies)
+	}
+}
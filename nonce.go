@@ -0,0 +1,55 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// GenerateTokenNonce generates a token bound to the nonce, e.g. one generated by the page for a single submission.
+// See TokenConfig.GenerateTokenNonce for details.
+func GenerateTokenNonce(sessionId, nonce string, expireAt time.Time, secret string) string {
+	return defaultConfig.GenerateTokenNonce(sessionId, nonce, expireAt, secret)
+}
+
+// ValidateTokenNonce checks if the token generated by GenerateTokenNonce is valid for the session and the nonce.
+func ValidateTokenNonce(token, sessionId, nonce string, now time.Time, secret string) bool {
+	return defaultConfig.ValidateTokenNonce(token, sessionId, nonce, now, secret)
+}
+
+// GenerateTokenNonce generates a token for the session bound to the nonce. The nonce is covered by the HMAC but not
+// embedded in the token, so the client has to send it back along with the token. Remembering the last nonce seen for
+// the session is then enough to reject a repeated submission. Nonce tokens are not valid as regular ones, unless
+// regular sessionIds can start with "nonce|".
+func (c *TokenConfig) GenerateTokenNonce(sessionId, nonce string, expireAt time.Time, secret string) string {
+	return c.GenerateToken(nonceSession(sessionId, nonce), expireAt, secret)
+}
+
+// ValidateTokenNonce checks if the token generated by GenerateTokenNonce is valid for the session and the nonce.
+func (c *TokenConfig) ValidateTokenNonce(token, sessionId, nonce string, now time.Time, secret string) bool {
+	return c.ValidateToken(token, nonceSession(sessionId, nonce), now, secret)
+}
+
+// nonceSession returns the sessionId covered by the HMAC of nonce tokens. The sessionId is length-prefixed,
+// so different sessionId/nonce pairs never produce the same value.
+func nonceSession(sessionId, nonce string) string {
+	return string(binary.AppendUvarint([]byte("nonce|"), uint64(len(sessionId)))) + sessionId + nonce
+}
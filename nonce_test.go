@@ -0,0 +1,60 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenNonce(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateTokenNonce(sessionId, "n0nce", now.Add(time.Minute), secret)
+
+	if !ValidateTokenNonce(token, sessionId, "n0nce", now, secret) {
+		t.Errorf("token was expected to be valid with its nonce")
+	}
+	if ValidateTokenNonce(token, sessionId, "other", now, secret) {
+		t.Errorf("token was expected to be invalid with another nonce")
+	}
+	if ValidateTokenNonce(token, "user2-login", "n0nce", now, secret) {
+		t.Errorf("token was expected to be invalid for another session")
+	}
+	if ValidateTokenNonce(token, sessionId, "n0nce", now.Add(2*time.Minute), secret) {
+		t.Errorf("expired token was expected to be invalid")
+	}
+}
+
+func TestTokenNonceIsNotRegularToken(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	if ValidateToken(GenerateTokenNonce("user1-login", "", now.Add(time.Minute), secret), "user1-login", now, secret) {
+		t.Errorf("nonce token was not expected to be valid as a regular token")
+	}
+	if ValidateTokenNonce(GenerateToken("user1-login", now.Add(time.Minute), secret), "user1-login", "", now, secret) {
+		t.Errorf("regular token was not expected to be valid as a nonce token")
+	}
+	if ValidateTokenNonce(GenerateTokenNonce("user1-", "login", now.Add(time.Minute), secret), "user1-log", "in", now, secret) {
+		t.Errorf("nonce token was not expected to be valid for another sessionId/nonce split")
+	}
+}
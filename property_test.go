@@ -0,0 +1,108 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto"
+	"math/rand/v2"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// propertyConfigs returns a config for every token encoding and hash, all issuing tokens at the time of now.
+func propertyConfigs(now time.Time) map[string]*TokenConfig {
+	clock := &FixedClock{Time: now}
+
+	return map[string]*TokenConfig{
+		"default":          {Clock: clock},
+		"IncludeIssuedAt":  {Clock: clock, IncludeIssuedAt: true, MaxAge: 30 * 24 * time.Hour},
+		"SHA256":           {Clock: clock, Hash: crypto.SHA256},
+		"SHA3_256":         {Clock: clock, Hash: crypto.SHA3_256},
+		"BLAKE2b_512":      {Clock: clock, Hash: crypto.BLAKE2b_512},
+		"OpaqueTimestamp":  {Clock: clock, OpaqueTimestamp: true, IncludeIssuedAt: true},
+		"Versioned":        {Clock: clock, Versioned: true},
+		"FixedWidth":       {Clock: clock, FixedWidth: true, IncludeIssuedAt: true, Versioned: true},
+		"FramedContents":   {Clock: clock, FramedContents: true, IncludeIssuedAt: true},
+		"RelativeExpiry":   {Clock: clock, RelativeExpiry: true, IncludeIssuedAt: true},
+		"Prefix":           {Clock: clock, Prefix: "app"},
+		"StretchSecret":    {Clock: clock, StretchSecret: true, StretchIterations: 1000},
+		"StrictSecret":     {Clock: clock, StrictSecret: true, MinSecretLength: 1},
+		"FixedWidthOpaque": {Clock: clock, FixedWidth: true, OpaqueTimestamp: true},
+		"DebugTimestamps":  {Clock: clock, DebugTimestamps: true, IncludeIssuedAt: true, FixedWidth: true},
+		"CaseInsensitive":  {Clock: clock, CaseInsensitiveHex: true},
+		"PadTimestamps":    {Clock: clock, PadTimestamps: true, IncludeIssuedAt: true},
+		"TimestampFirst":   {Clock: clock, TimestampFirst: true, IncludeIssuedAt: true, Versioned: true},
+		"BLAKE2Keyed":      {Clock: clock, MACMode: BLAKE2Keyed},
+	}
+}
+
+// randomString returns a random string of up to 64 bytes, either ASCII, unicode or arbitrary binary data.
+func randomString(r *rand.Rand) string {
+	n := r.IntN(65)
+	b := make([]byte, 0, n)
+	switch r.IntN(3) {
+	case 0:
+		for len(b) < n {
+			b = append(b, byte(' '+r.IntN(95)))
+		}
+	case 1:
+		for len(b) < n {
+			b = utf8.AppendRune(b, rune(r.IntN(0x10000)))
+		}
+	default:
+		for len(b) < n {
+			b = append(b, byte(r.IntN(256)))
+		}
+	}
+
+	return string(b)
+}
+
+func TestTokensAreValidExactlyWithinTheirWindow(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	for name, config := range propertyConfigs(now) {
+		for i := 0; i < 200; i++ {
+			sessionId := randomString(r)
+			secret := randomString(r)
+			if i == 0 {
+				sessionId = ""
+			}
+			if secret == "" && config.StrictSecret {
+				secret = "LoremIpsum123"
+			}
+			ttl := time.Duration(1+r.Int64N(10*24*60*60)) * time.Second
+			expireAt := now.Add(ttl)
+			token := config.GenerateToken(sessionId, expireAt, secret)
+
+			inside := now.Add(time.Duration(r.Int64N(int64(ttl) + 1)))
+			if !config.ValidateToken(token, sessionId, inside, secret) {
+				t.Errorf("%s: token was expected to be valid at %s: sessionId=%q, ttl=%s, token=%s", name, inside, sessionId, ttl, token)
+			}
+
+			past := expireAt.Add(time.Second + time.Duration(r.Int64N(int64(24*time.Hour))))
+			if config.ValidateToken(token, sessionId, past, secret) {
+				t.Errorf("%s: token was expected to be invalid at %s: sessionId=%q, ttl=%s, token=%s", name, past, sessionId, ttl, token)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"time"
+)
+
+// readerTag is appended to the HMAC input of reader tokens. The input of other tokens always ends with a timestamp,
+// which never matches the tag, so reader tokens are never valid as other tokens, and vice versa.
+const readerTag = "|reader"
+
+// GenerateTokenContext generates a token like GenerateToken, unless the context is already done.
+func GenerateTokenContext(ctx context.Context, sessionId string, expireAt time.Time, secret string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return GenerateToken(sessionId, expireAt, secret), nil
+}
+
+// GenerateTokenReader generates a token like GenerateToken, additionally bound to all data read from r.
+// The token is valid only when the same data is passed to ValidateTokenReader.
+func GenerateTokenReader(sessionId string, r io.Reader, expireAt time.Time, secret string) (string, error) {
+	return GenerateTokenReaderContext(context.Background(), sessionId, r, expireAt, secret)
+}
+
+// GenerateTokenReaderContext works like GenerateTokenReader, but stops waiting for r and returns ctx.Err()
+// when the context is done. A reader blocked at that moment is still drained in the background until it returns,
+// so r must not be used after a canceled call.
+func GenerateTokenReaderContext(ctx context.Context, sessionId string, r io.Reader, expireAt time.Time, secret string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	ts := strconv.FormatInt(expireAt.Unix(), 10)
+	hash, err := hmacTokenReader(ctx, sessionId, ts, r, secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hash + TokenTimestampSeparator + ts, nil
+}
+
+// ValidateTokenReader checks if the token generated by GenerateTokenReader is valid for the session and the data
+// read from r, and has not expired.
+func ValidateTokenReader(token, sessionId string, r io.Reader, now time.Time, secret string) bool {
+	parsed, err := ParseToken(token)
+	if err != nil {
+		return false
+	}
+
+	// like in ValidateToken, the HMAC is checked before the expiration date, so the time it takes doesn't tell them apart
+	hashSample, err := hmacTokenReader(context.Background(), sessionId, parsed.RawTimestamp, r, secret)
+	if err != nil {
+		return false
+	}
+	match := subtle.ConstantTimeCompare([]byte(parsed.Hash), []byte(hashSample))
+
+	return match == 1 && !parsed.ExpiresAt.Before(now)
+}
+
+// hmacTokenReader returns the hex encoded HMAC of the length-prefixed sessionId, the timestamp, the data read from r
+// followed by its length, and the readerTag.
+func hmacTokenReader(ctx context.Context, sessionId, ts string, r io.Reader, secret string) (string, error) {
+	hash := hmac.New(crypto.SHA512_224.New, []byte(secret))
+	hash.Write(binary.AppendUvarint([]byte("reader|"), uint64(len(sessionId))))
+	hash.Write([]byte(sessionId + "|" + ts + "|"))
+
+	done := make(chan error, 1)
+	var size int64
+	go func() {
+		var err error
+		size, err = io.Copy(hash, r)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", err
+		}
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	// the data is streamed, so its length frames it from the end
+	hash.Write(binary.BigEndian.AppendUint64(nil, uint64(size)))
+	hash.Write([]byte(readerTag))
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,101 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type blockingReader struct {
+	unblock chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	<-r.unblock
+
+	return 0, context.Canceled
+}
+
+func TestValidTokenReaderFlow(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+
+	token, err := GenerateTokenReader(sessionId, strings.NewReader("lorem ipsum dolor sit amet"), expireAt, secret)
+	if err != nil {
+		t.Fatalf("token generation failed: %s", err)
+	}
+
+	if !ValidateTokenReader(token, sessionId, strings.NewReader("lorem ipsum dolor sit amet"), now, secret) {
+		t.Errorf("token validation failed: token=%s, sessionId=%s, expireAt=%s, secret=%s, now=%s", token, sessionId, expireAt, secret, now)
+	}
+
+	if ValidateTokenReader(token, sessionId, strings.NewReader("lorem ipsum dolor sit"), now, secret) {
+		t.Errorf("token validation was expected to fail for different data, but passed: token=%s", token)
+	}
+
+	if ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("token validation was expected to fail without data, but passed: token=%s", token)
+	}
+}
+
+func TestRegularTokenIsNotValidReaderToken(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+	expireAt := now.Add(5 * time.Minute)
+	ts := strconv.FormatInt(expireAt.Unix(), 10)
+
+	// without domain separation, the HMAC input of this token equals the one of the reader token for user1-login
+	token := GenerateToken("user1-login|"+ts, expireAt, secret)
+	if ValidateTokenReader(token, "user1-login", strings.NewReader(ts), now, secret) {
+		t.Errorf("regular token was not expected to be valid as a reader token: %s", token)
+	}
+}
+
+func TestCanceledContextAbortsTokenGeneration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &blockingReader{unblock: make(chan struct{})}
+	defer close(r.unblock)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	token, err := GenerateTokenReaderContext(ctx, "user1-login", r, time.Now().Add(5*time.Minute), "LoremIpsum123")
+
+	if err != context.Canceled || token != "" {
+		t.Errorf("token generation was expected to be canceled: token=%s, err=%v", token, err)
+	}
+}
+
+func TestCanceledContextIsCheckedAtEntry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := GenerateTokenContext(ctx, "user1-login", time.Now().Add(5*time.Minute), "LoremIpsum123"); err != context.Canceled {
+		t.Errorf("token generation was expected to be canceled, got: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"time"
+)
+
+// ReqOption configures where ValidateRequest looks for the token.
+type ReqOption func(*reqOptions)
+
+type reqOptions struct {
+	headerName, fieldName string
+}
+
+// WithHeaderName sets the request header carrying the token, "X-CSRF-Token" by default.
+func WithHeaderName(name string) ReqOption {
+	return func(o *reqOptions) {
+		o.headerName = name
+	}
+}
+
+// WithFieldName sets the form field carrying the token, used when the header is empty, "csrf_token" by default.
+func WithFieldName(name string) ReqOption {
+	return func(o *reqOptions) {
+		o.fieldName = name
+	}
+}
+
+// ValidateRequest validates the token sent with the request, like Middleware does, for handlers that don't use it.
+// See TokenConfig.ValidateRequest for details.
+func ValidateRequest(r *http.Request, sessionId string, now time.Time, secret string, opts ...ReqOption) bool {
+	return defaultConfig.ValidateRequest(r, sessionId, now, secret, opts...)
+}
+
+// ValidateRequest reads the token from the X-CSRF-Token header or, when it is empty, the csrf_token form field
+// (the names can be changed with WithHeaderName and WithFieldName) and validates it like ValidateToken.
+// Requests without a token are invalid.
+func (c *TokenConfig) ValidateRequest(r *http.Request, sessionId string, now time.Time, secret string, opts ...ReqOption) bool {
+	o := reqOptions{headerName: "X-CSRF-Token", fieldName: "csrf_token"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	config := MiddlewareConfig{HeaderName: o.headerName, FieldName: o.fieldName}
+
+	return c.ValidateToken(config.requestToken(r), sessionId, now, secret)
+}
@@ -0,0 +1,77 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateRequest(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(time.Minute), secret)
+
+	header := httptest.NewRequest(http.MethodPost, "/", nil)
+	header.Header.Set("X-CSRF-Token", token)
+	if !ValidateRequest(header, sessionId, now, secret) {
+		t.Errorf("token in the header was expected to be valid")
+	}
+
+	form := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !ValidateRequest(form, sessionId, now, secret) {
+		t.Errorf("token in the form was expected to be valid")
+	}
+
+	if ValidateRequest(httptest.NewRequest(http.MethodPost, "/", nil), sessionId, now, secret) {
+		t.Errorf("request without a token was expected to be invalid")
+	}
+	if ValidateRequest(header, "user2-login", now, secret) {
+		t.Errorf("token was expected to be invalid for another session")
+	}
+}
+
+func TestValidateRequestWithCustomNames(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateToken(sessionId, now.Add(time.Minute), secret)
+
+	header := httptest.NewRequest(http.MethodPost, "/", nil)
+	header.Header.Set("X-XSRF-Token", token)
+	if !ValidateRequest(header, sessionId, now, secret, WithHeaderName("X-XSRF-Token")) {
+		t.Errorf("token in the custom header was expected to be valid")
+	}
+	if ValidateRequest(header, sessionId, now, secret) {
+		t.Errorf("token in the custom header was not expected to be found by default")
+	}
+
+	form := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"_token": {token}}.Encode()))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !ValidateRequest(form, sessionId, now, secret, WithFieldName("_token")) {
+		t.Errorf("token in the custom field was expected to be valid")
+	}
+}
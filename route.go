@@ -0,0 +1,60 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// GenerateTokenRoute generates a token valid only for requests with the method to the path, e.g. "POST" and "/x".
+// See TokenConfig.GenerateTokenRoute for details.
+func GenerateTokenRoute(sessionId, method, path string, expireAt time.Time, secret string) string {
+	return defaultConfig.GenerateTokenRoute(sessionId, method, path, expireAt, secret)
+}
+
+// ValidateTokenRoute checks if the token generated by GenerateTokenRoute is valid for the session, the method and the path.
+func ValidateTokenRoute(token, sessionId, method, path string, now time.Time, secret string) bool {
+	return defaultConfig.ValidateTokenRoute(token, sessionId, method, path, now, secret)
+}
+
+// GenerateTokenRoute generates a token for the session bound to the method and the path, so it can't be used for
+// another route, e.g. a token for a form submitted with POST to /x is not valid for DELETE /x nor POST /y.
+// The route is covered by the HMAC but not embedded in the token. The token is generated for RouteSessionId, so it is
+// not valid as a regular token, unless regular sessionIds can start with "route|".
+func (c *TokenConfig) GenerateTokenRoute(sessionId, method, path string, expireAt time.Time, secret string) string {
+	return c.GenerateToken(RouteSessionId(sessionId, method, path), expireAt, secret)
+}
+
+// ValidateTokenRoute checks if the token generated by GenerateTokenRoute is valid for the session, the method and the path.
+func (c *TokenConfig) ValidateTokenRoute(token, sessionId, method, path string, now time.Time, secret string) bool {
+	return c.ValidateToken(token, RouteSessionId(sessionId, method, path), now, secret)
+}
+
+// RouteSessionId returns the sessionId route tokens are generated for, e.g. to bind tokens of another Codec to a route.
+// The sessionId and the method are length-prefixed, so different combinations never produce the same value.
+func RouteSessionId(sessionId, method, path string) string {
+	b := binary.AppendUvarint([]byte("route|"), uint64(len(sessionId)))
+	b = append(b, sessionId...)
+	b = binary.AppendUvarint(b, uint64(len(method)))
+	b = append(b, method...)
+
+	return string(append(b, path...))
+}
@@ -0,0 +1,77 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenRoute(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateTokenRoute(sessionId, http.MethodPost, "/x", now.Add(time.Minute), secret)
+
+	if !ValidateTokenRoute(token, sessionId, http.MethodPost, "/x", now, secret) {
+		t.Errorf("token was expected to be valid for its route")
+	}
+	if ValidateTokenRoute(token, sessionId, http.MethodDelete, "/x", now, secret) {
+		t.Errorf("token was expected to be invalid for another method")
+	}
+	if ValidateTokenRoute(token, sessionId, http.MethodPost, "/y", now, secret) {
+		t.Errorf("token was expected to be invalid for another path")
+	}
+	if ValidateTokenRoute(token, "user2-login", http.MethodPost, "/x", now, secret) {
+		t.Errorf("token was expected to be invalid for another session")
+	}
+	if ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("route token was not expected to be valid as a regular token")
+	}
+}
+
+func TestMiddlewareBindRoute(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.BindRoute = true
+	token := GenerateTokenRoute("user1-login", http.MethodPost, "/x", time.Now().Add(time.Minute), "LoremIpsum123")
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodPost, "/x", http.StatusOK},
+		{http.MethodDelete, "/x", http.StatusForbidden},
+		{http.MethodPost, "/y", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		r.Header.Set("X-CSRF-Token", token)
+		if w, _ := serveMiddleware(config, r); w.Code != tc.code {
+			t.Errorf("%s %s was expected to return %d, got: %d", tc.method, tc.path, tc.code, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/x", nil)
+	r.Header.Set("X-CSRF-Token", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+		t.Errorf("unbound token was expected to be rejected, got: %d", w.Code)
+	}
+}
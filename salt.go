@@ -0,0 +1,67 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"time"
+)
+
+// saltedSecretInfo is the HKDF context of the keys derived by saltedSecret.
+const saltedSecretInfo = "csrf: salted secret"
+
+// GenerateTokenSalted generates a token with the key derived from the secret and the salt.
+// See TokenConfig.GenerateTokenSalted for details.
+func GenerateTokenSalted(sessionId string, expireAt time.Time, secret, salt string) string {
+	return defaultConfig.GenerateTokenSalted(sessionId, expireAt, secret, salt)
+}
+
+// ValidateTokenSalted checks if the token generated by GenerateTokenSalted is valid for the secret and the salt.
+func ValidateTokenSalted(token, sessionId string, now time.Time, secret, salt string) bool {
+	return defaultConfig.ValidateTokenSalted(token, sessionId, now, secret, salt)
+}
+
+// GenerateTokenSalted generates a token like GenerateToken, with the key derived with HKDF-SHA-256 from the secret
+// and the salt, e.g. a salt changed on every deploy next to a long-lived secret. Changing the salt invalidates all
+// tokens generated with the previous one.
+func (c *TokenConfig) GenerateTokenSalted(sessionId string, expireAt time.Time, secret, salt string) string {
+	return c.GenerateToken(sessionId, expireAt, saltedSecret(secret, salt))
+}
+
+// ValidateTokenSalted checks if the token generated by GenerateTokenSalted is valid for the secret and the salt.
+func (c *TokenConfig) ValidateTokenSalted(token, sessionId string, now time.Time, secret, salt string) bool {
+	// the derived key is never empty, so an empty secret is passed on as is for StrictSecret to reject it
+	if c.StrictSecret && secret == "" {
+		return c.ValidateToken(token, sessionId, now, secret)
+	}
+
+	return c.ValidateToken(token, sessionId, now, saltedSecret(secret, salt))
+}
+
+// saltedSecret derives the key of salted tokens from the secret and the salt.
+func saltedSecret(secret, salt string) string {
+	key, err := hkdf.Key(sha256.New, []byte(secret), []byte(salt), saltedSecretInfo, sha256.Size)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(key)
+}
@@ -0,0 +1,62 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenSalted(t *testing.T) {
+	sessionId := "user1-login"
+	secret := "LoremIpsum123"
+	now := time.Now()
+	token := GenerateTokenSalted(sessionId, now.Add(time.Minute), secret, "deploy-a")
+
+	if !ValidateTokenSalted(token, sessionId, now, secret, "deploy-a") {
+		t.Errorf("token was expected to be valid with its salt")
+	}
+	if ValidateTokenSalted(token, sessionId, now, secret, "deploy-b") {
+		t.Errorf("token was expected to be invalid with another salt")
+	}
+	if ValidateTokenSalted(token, sessionId, now, "LoremIpsum124", "deploy-a") {
+		t.Errorf("token was expected to be invalid with another secret")
+	}
+	if ValidateTokenSalted(token, "user2-login", now, secret, "deploy-a") {
+		t.Errorf("token was expected to be invalid for another session")
+	}
+	if ValidateToken(token, sessionId, now, secret) {
+		t.Errorf("salted token was not expected to be valid without the salt")
+	}
+	if ValidateTokenSalted(GenerateToken(sessionId, now.Add(time.Minute), secret), sessionId, now, secret, "") {
+		t.Errorf("unsalted token was not expected to be valid with an empty salt")
+	}
+}
+
+func TestTokenSaltedStrictSecret(t *testing.T) {
+	sessionId := "user1-login"
+	now := time.Now()
+	config := &TokenConfig{StrictSecret: true}
+	token := config.GenerateTokenSalted(sessionId, now.Add(time.Minute), "", "deploy-a")
+
+	if config.ValidateTokenSalted(token, sessionId, now, "", "deploy-a") {
+		t.Errorf("token was expected to be rejected for an empty secret")
+	}
+}
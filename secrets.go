@@ -0,0 +1,124 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"sync"
+	"time"
+)
+
+// SecretRing holds the secrets for zero-downtime rotation: tokens are generated with the newest secret
+// and validated with every secret that is still valid, so tokens issued before the rotation keep working
+// until the old secret's validUntil passes. The zero value is an empty ring using the default TokenConfig.
+// SecretRing is safe for concurrent use.
+type SecretRing struct {
+	// Config is used to generate and validate the tokens, the zero TokenConfig by default.
+	Config *TokenConfig
+
+	mu      sync.RWMutex
+	secrets []ringSecret
+}
+
+type ringSecret struct {
+	secret     string
+	validUntil time.Time
+}
+
+// Add adds the secret as the newest one, accepted by validation until validUntil.
+func (r *SecretRing) Add(secret string, validUntil time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.secrets = append(r.secrets, ringSecret{secret: secret, validUntil: validUntil})
+}
+
+// Current returns the newest secret still valid at the time returned by the Clock of the config,
+// or an empty string if there is none.
+func (r *SecretRing) Current() string {
+	secret, _ := r.current()
+
+	return secret
+}
+
+// GenerateToken generates a token with the newest secret still valid, see Current.
+// It panics with ErrNoSecrets when there is none, rather than signing the token with an empty secret.
+func (r *SecretRing) GenerateToken(sessionId string, expireAt time.Time) string {
+	secret, ok := r.current()
+	if !ok {
+		panic(ErrNoSecrets)
+	}
+
+	return r.config().GenerateToken(sessionId, expireAt, secret)
+}
+
+// current returns the newest secret still valid at the time returned by the Clock, and whether there is one.
+func (r *SecretRing) current() (string, bool) {
+	now := r.config().now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.secrets) - 1; i >= 0; i-- {
+		if !r.secrets[i].validUntil.Before(now) {
+			return r.secrets[i].secret, true
+		}
+	}
+
+	return "", false
+}
+
+// ValidateToken checks the token with every secret valid at now, after pruning the ones that are not.
+// Every valid secret is checked, like in Manager.Validate.
+func (r *SecretRing) ValidateToken(token, sessionId string, now time.Time) bool {
+	secrets := r.prune(now)
+	parsed, reason := r.config().validateSecrets(token, sessionId, now, len(secrets), func(i int) string {
+		return secrets[i]
+	})
+	r.config().report(token, sessionId, &parsed, reason)
+
+	return reason == ""
+}
+
+// prune removes the secrets that are no longer valid at now and returns the remaining ones.
+func (r *SecretRing) prune(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.secrets[:0]
+	secrets := make([]string, 0, len(r.secrets))
+	for _, s := range r.secrets {
+		if s.validUntil.Before(now) {
+			continue
+		}
+		kept = append(kept, s)
+		secrets = append(secrets, s.secret)
+	}
+	r.secrets = kept
+
+	return secrets
+}
+
+func (r *SecretRing) config() *TokenConfig {
+	if r.Config == nil {
+		return defaultConfig
+	}
+
+	return r.Config
+}
@@ -0,0 +1,115 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretRingRotation(t *testing.T) {
+	sessionId := "user1-login"
+	now := time.Now()
+	expireAt := now.Add(time.Hour)
+	ring := &SecretRing{}
+
+	ring.Add("LoremIpsum123", now.Add(10*time.Minute))
+	oldToken := ring.GenerateToken(sessionId, expireAt)
+
+	ring.Add("DolorSitAmet456", now.Add(2*time.Hour))
+	newToken := ring.GenerateToken(sessionId, expireAt)
+
+	if ring.Current() != "DolorSitAmet456" {
+		t.Errorf("the newest secret was expected to be current, got: %s", ring.Current())
+	}
+	if !ValidateToken(newToken, sessionId, now, "DolorSitAmet456") {
+		t.Errorf("new token was expected to be generated with the newest secret: token=%s", newToken)
+	}
+
+	// overlap window, both secrets are valid
+	overlap := now.Add(5 * time.Minute)
+	if !ring.ValidateToken(oldToken, sessionId, overlap) || !ring.ValidateToken(newToken, sessionId, overlap) {
+		t.Errorf("tokens of both secrets were expected to be valid during the overlap")
+	}
+
+	// the old secret is no longer valid and gets pruned
+	afterOverlap := now.Add(15 * time.Minute)
+	if ring.ValidateToken(oldToken, sessionId, afterOverlap) {
+		t.Errorf("old token validation was expected to fail after the old secret's validUntil, but passed: token=%s", oldToken)
+	}
+	if !ring.ValidateToken(newToken, sessionId, afterOverlap) {
+		t.Errorf("new token validation failed after the overlap: token=%s", newToken)
+	}
+	if len(ring.secrets) != 1 {
+		t.Errorf("the old secret was expected to be pruned, got %d secrets", len(ring.secrets))
+	}
+}
+
+func TestEmptySecretRingRejectsTokens(t *testing.T) {
+	ring := &SecretRing{}
+	now := time.Now()
+
+	if ring.ValidateToken(GenerateToken("user1-login", now.Add(time.Hour), ""), "user1-login", now) {
+		t.Errorf("empty ring was expected to reject every token")
+	}
+}
+
+func TestSecretRingGenerationNeedsValidSecret(t *testing.T) {
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	ring := &SecretRing{Config: &TokenConfig{Clock: &FixedClock{Time: now}}}
+	ring.Add("LoremIpsum123", now.Add(time.Hour))
+	ring.Add("DolorSitAmet456", now.Add(-time.Minute))
+
+	if ring.Current() != "LoremIpsum123" {
+		t.Errorf("the newest secret still valid was expected to be current, got: %s", ring.Current())
+	}
+
+	ring.prune(now.Add(2 * time.Hour))
+	if ring.Current() != "" {
+		t.Errorf("no secret was expected to be current, got: %s", ring.Current())
+	}
+	defer func() {
+		if r := recover(); r != ErrNoSecrets {
+			t.Errorf("GenerateToken was expected to panic with ErrNoSecrets, got: %v", r)
+		}
+	}()
+	ring.GenerateToken("user1-login", now.Add(time.Minute))
+}
+
+func TestSecretRingReportsOnce(t *testing.T) {
+	sessionId := "user1-login"
+	now := time.Now()
+	metrics := &fakeMetrics{}
+	ring := &SecretRing{Config: &TokenConfig{Metrics: metrics}}
+	ring.Add("LoremIpsum123", now.Add(time.Hour))
+	token := ring.GenerateToken(sessionId, now.Add(time.Minute))
+	ring.Add("DolorSitAmet456", now.Add(time.Hour))
+
+	if !ring.ValidateToken(token, sessionId, now) {
+		t.Errorf("token generated with the older secret was expected to be valid")
+	}
+	ring.ValidateToken(token, "user2-login", now)
+	ring.ValidateToken(token, sessionId, now.Add(2*time.Minute))
+
+	if got := strings.Join(metrics.validated, ","); got != "valid,mismatch,expired" {
+		t.Errorf("every validation was expected to be reported once, got: %s", got)
+	}
+}
@@ -0,0 +1,65 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOperationSessionDoesNotCollide(t *testing.T) {
+	pairs := [][2]string{
+		{"ab", "c"},
+		{"a", "bc"},
+		{"abc", ""},
+		{"", "abc"},
+		{"a\x01", "bc"},
+		{"a", "\x01bc"},
+	}
+
+	seen := make(map[string][2]string)
+	for _, pair := range pairs {
+		sessionId := OperationSession(pair[0], pair[1])
+		if other, ok := seen[sessionId]; ok {
+			t.Errorf("sessionIds of %q and %q were expected to differ", pair, other)
+		}
+		seen[sessionId] = pair
+	}
+}
+
+func TestOperationSessionIsStable(t *testing.T) {
+	if OperationSession("user1", "login") != OperationSession("user1", "login") {
+		t.Errorf("sessionIds of the same pair were expected to be equal")
+	}
+}
+
+func TestOperationSessionTokensAreIndependent(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	token := GenerateToken(OperationSession("user1", "login"), now.Add(time.Minute), secret)
+
+	if !ValidateToken(token, OperationSession("user1", "login"), now, secret) {
+		t.Errorf("token was expected to be valid for the same operation")
+	}
+	if ValidateToken(token, OperationSession("user1", "delete-account"), now, secret) {
+		t.Errorf("token was expected to be invalid for other operation")
+	}
+}
@@ -0,0 +1,72 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import "crypto/subtle"
+
+// signerTag is appended to the MAC input of the Signer. The token MAC input always ends with a timestamp, which never
+// matches the tag, so the MAC of any data never matches the MAC of a token. A prefix would not do, as any sessionId can
+// precede the timestamp in the token MAC input.
+const signerTag = "|signer"
+
+// Signer returns a function computing the MAC of data with the secret, with the same HMAC the tokens are signed with.
+// See TokenConfig.Signer for details.
+func Signer(secret string) func(data []byte) []byte {
+	return defaultConfig.Signer(secret)
+}
+
+// Verifier returns a function checking the MAC computed by the Signer for the same secret.
+func Verifier(secret string) func(data, mac []byte) bool {
+	return defaultConfig.Verifier(secret)
+}
+
+// Signer returns a function computing the raw MAC of data with the secret, using the HMAC of the config (its Hash,
+// and StretchSecret), e.g. to sign other data next to the tokens. The input is tagged, so the MAC of any data,
+// including user-influenced data, is never a valid token MAC. The functions are safe for concurrent use.
+func (c *TokenConfig) Signer(secret string) func(data []byte) []byte {
+	return func(data []byte) []byte {
+		return c.taggedMAC(secret, data, signerTag)
+	}
+}
+
+// Verifier returns a function checking in constant time that mac is the MAC the Signer computes for data.
+// With StrictSecret, the function rejects every MAC for an empty secret.
+func (c *TokenConfig) Verifier(secret string) func(data, mac []byte) bool {
+	sign := c.Signer(secret)
+
+	return func(data, mac []byte) bool {
+		if c.StrictSecret && secret == "" {
+			return false
+		}
+
+		return subtle.ConstantTimeCompare(sign(data), mac) == 1
+	}
+}
+
+// taggedMAC returns a copy of the raw MAC of data followed by the tag, which keeps the MACs computed for different
+// purposes apart.
+func (c *TokenConfig) taggedMAC(secret string, data []byte, tag string) []byte {
+	m := c.getMac()
+	defer c.putMac(m)
+
+	m.setKey(c.key(secret))
+
+	return append([]byte(nil), m.keyedSumOf(data, []byte(tag))...)
+}
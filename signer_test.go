@@ -0,0 +1,94 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestVerifierAcceptsSignerOutput(t *testing.T) {
+	secret := "LoremIpsum123"
+	data := []byte("user1-login|1609787986")
+	mac := Signer(secret)(data)
+
+	expected := hmac.New(sha512.New512_224, []byte(secret))
+	expected.Write(data)
+	expected.Write([]byte(signerTag))
+	if !hmac.Equal(mac, expected.Sum(nil)) {
+		t.Errorf("Signer was expected to compute HMAC-SHA-512/224 of the tagged data, got: %x", mac)
+	}
+
+	verify := Verifier(secret)
+	if !verify(data, mac) {
+		t.Errorf("Verifier was expected to accept the Signer output")
+	}
+
+	tampered := append([]byte(nil), mac...)
+	tampered[0] ^= 1
+	if verify(data, tampered) {
+		t.Errorf("Verifier was expected to reject a tampered MAC")
+	}
+	if verify([]byte("user2-login|1609787986"), mac) {
+		t.Errorf("Verifier was expected to reject the MAC of other data")
+	}
+	if Verifier("DolorSitAmet456")(data, mac) {
+		t.Errorf("Verifier was expected to reject the MAC computed with another secret")
+	}
+}
+
+func TestSignerNeverMatchesTokenMAC(t *testing.T) {
+	secret := "LoremIpsum123"
+
+	for _, config := range []*TokenConfig{{}, {Hash: crypto.SHA256}} {
+		mac := config.Signer(secret)([]byte(tokenContents("victim", "4000000000")))
+		if hmac.Equal(mac, config.tokenMAC("victim", []string{"4000000000"}, secret)) {
+			t.Errorf("Signer was not expected to compute the MAC the tokens are signed with")
+		}
+
+		token := hex.EncodeToString(mac) + TokenTimestampSeparator + "4000000000"
+		if config.ValidateToken(token, "victim", time.Now(), secret) {
+			t.Errorf("Signer output was not expected to be a valid token: %s", token)
+		}
+	}
+}
+
+func TestSignerDoesNotCopyDataIntoPool(t *testing.T) {
+	secret := "LoremIpsum123"
+	data := make([]byte, 1<<20)
+	mac := Signer(secret)(data)
+
+	expected := hmac.New(sha512.New512_224, []byte(secret))
+	expected.Write(data)
+	expected.Write([]byte(signerTag))
+	if !hmac.Equal(mac, expected.Sum(nil)) {
+		t.Errorf("Signer was expected to compute HMAC-SHA-512/224 of the tagged data, got: %x", mac)
+	}
+
+	m := getMac(crypto.SHA512_224)
+	defer putMac(crypto.SHA512_224, m)
+	if cap(m.buf) >= len(data) {
+		t.Errorf("Signer was not expected to copy the data into the pooled state, got buffer of %d bytes", cap(m.buf))
+	}
+}
@@ -0,0 +1,148 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// opaqueTimestampMask is XOR-ed with opaque timestamps, so they don't look like unix time.
+const opaqueTimestampMask = 0x6373726674696d65
+
+// debugTimestampLayout formats the timestamps of TokenConfig.DebugTimestamps, always in UTC.
+const debugTimestampLayout = "2006-01-02T15:04:05Z"
+
+// maxDecimalTimestamp is the unix time of the last second of year 9999.
+const maxDecimalTimestamp = 253402300799
+
+// maxDecimalTimestampLength is the length of maxDecimalTimestamp, the width of padded timestamps.
+var maxDecimalTimestampLength = len(strconv.FormatInt(maxDecimalTimestamp, 10))
+
+// timestampLength returns the maximum length of a timestamp segment.
+func (c *TokenConfig) timestampLength() int {
+	if c.DebugTimestamps {
+		return len(debugTimestampLayout)
+	}
+	if c.OpaqueTimestamp {
+		return base64.RawURLEncoding.EncodedLen(8)
+	}
+
+	return maxDecimalTimestampLength
+}
+
+// formatTimestamp encodes the time as a token segment.
+func (c *TokenConfig) formatTimestamp(t time.Time) string {
+	if c.DebugTimestamps {
+		return t.UTC().Format(debugTimestampLayout)
+	}
+	if !c.OpaqueTimestamp {
+		ts := strconv.FormatInt(t.Unix(), 10)
+		if c.padTimestamps() && len(ts) < c.timestampLength() {
+			ts = strings.Repeat("0", c.timestampLength()-len(ts)) + ts
+		}
+
+		return ts
+	}
+
+	var raw [8]byte
+	binary.BigEndian.PutUint64(raw[:], uint64(t.Unix())^opaqueTimestampMask)
+
+	return base64.RawURLEncoding.EncodeToString(raw[:])
+}
+
+// parseTimestamp decodes the token segment encoded by formatTimestamp.
+// Timestamps after the Horizon and encodings formatTimestamp would not produce, e.g. "+123" or "0123",
+// are rejected with ErrBadTimestamp, so every instant has exactly one encoding.
+func (c *TokenConfig) parseTimestamp(segment string) (time.Time, error) {
+	ts, err := c.decodeTimestamp(segment)
+	if err != nil || ts > c.horizon().Unix() {
+		return time.Time{}, ErrBadTimestamp
+	}
+
+	return time.Unix(ts, 0), nil
+}
+
+func (c *TokenConfig) decodeTimestamp(segment string) (int64, error) {
+	if c.DebugTimestamps {
+		t, err := time.Parse(debugTimestampLayout, segment)
+		// the layout accepts e.g. a single-digit hour, the canonical encoding is the one formatTimestamp produces
+		if err != nil || t.Format(debugTimestampLayout) != segment {
+			return 0, ErrBadTimestamp
+		}
+
+		return t.Unix(), nil
+	}
+	if !c.OpaqueTimestamp {
+		if !c.canonicalDecimal(segment) {
+			return 0, ErrBadTimestamp
+		}
+
+		return strconv.ParseInt(segment, 10, 64)
+	}
+
+	var raw [8]byte
+	if base64.RawURLEncoding.DecodedLen(len(segment)) != len(raw) {
+		return 0, ErrBadTimestamp
+	}
+	// strict decoding rejects non-zero padding bits, which would give the same timestamp another encoding
+	if _, err := base64.RawURLEncoding.Strict().Decode(raw[:], []byte(segment)); err != nil {
+		return 0, ErrBadTimestamp
+	}
+
+	return int64(binary.BigEndian.Uint64(raw[:]) ^ opaqueTimestampMask), nil
+}
+
+// canonicalDecimal reports whether the segment is a decimal timestamp as formatted by formatTimestamp:
+// digits only, with an optional leading "-" and no leading zeros, or zero-padded to the full width with padTimestamps.
+func (c *TokenConfig) canonicalDecimal(segment string) bool {
+	digits := segment
+	if c.padTimestamps() && len(segment) != c.timestampLength() {
+		return false
+	}
+	if !c.padTimestamps() {
+		digits = strings.TrimPrefix(segment, "-")
+		if digits == "" || (digits[0] == '0' && len(segment) > 1) {
+			return false
+		}
+	}
+
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fixedWidthTimestamps reports whether the timestamps are always timestampLength long and may contain characters
+// other than digits.
+func (c *TokenConfig) fixedWidthTimestamps() bool {
+	return c.OpaqueTimestamp || c.DebugTimestamps
+}
+
+// padTimestamps reports whether decimal timestamps are zero-padded to timestampLength.
+func (c *TokenConfig) padTimestamps() bool {
+	return c.FixedWidth || c.PadTimestamps
+}
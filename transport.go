@@ -0,0 +1,74 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"time"
+)
+
+// Transport is an http.RoundTripper sending a fresh token with every unsafe request, e.g. for service-to-service
+// calls to a server protected by Middleware.
+type Transport struct {
+	// Base performs the requests, http.DefaultTransport by default.
+	Base http.RoundTripper
+	// Config is used to generate the tokens, the zero TokenConfig by default.
+	Config *TokenConfig
+	// Secret is used to generate the tokens.
+	Secret string
+	// TTL is the lifetime of the tokens, one minute by default.
+	TTL time.Duration
+	// SessionId returns the sessionId of the request, see GenerateToken for details.
+	SessionId func(r *http.Request) string
+	// HeaderName is the request header the token is sent in, "X-CSRF-Token" by default.
+	HeaderName string
+}
+
+// NewTransport returns a Transport sending tokens generated with the secret in the X-CSRF-Token header.
+func NewTransport(base http.RoundTripper, secret string, sessionIdFn func(*http.Request) string, ttl time.Duration) *Transport {
+	return &Transport{Base: base, Secret: secret, SessionId: sessionIdFn, TTL: ttl}
+}
+
+// RoundTrip adds the token to unsafe requests and performs them with Base. The request is not modified.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if isSafeMethod(r.Method) {
+		return base.RoundTrip(r)
+	}
+
+	config, ttl, header := t.Config, t.TTL, t.HeaderName
+	if config == nil {
+		config = defaultConfig
+	}
+	if ttl == 0 {
+		ttl = time.Minute
+	}
+	if header == "" {
+		header = "X-CSRF-Token"
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set(header, config.GenerateTokenTTL(t.SessionId(r), ttl, t.Secret))
+
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,83 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransportAddsTokenToUnsafeRequests(t *testing.T) {
+	var sent *http.Request
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		sent = r
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	transport := NewTransport(base, "LoremIpsum123", func(r *http.Request) string {
+		return "service1-" + r.URL.Path
+	}, time.Minute)
+
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/orders", nil)
+	if _, err := transport.RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+
+	token := sent.Header.Get("X-CSRF-Token")
+	if !ValidateToken(token, "service1-/orders", time.Now(), "LoremIpsum123") {
+		t.Errorf("sent token was expected to be valid: %q", token)
+	}
+	if r.Header.Get("X-CSRF-Token") != "" {
+		t.Errorf("original request was not expected to be modified")
+	}
+
+	if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com/orders", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Header.Get("X-CSRF-Token") != "" {
+		t.Errorf("token was not expected to be sent with a safe request")
+	}
+}
+
+func TestTransportPassesMiddleware(t *testing.T) {
+	server := httptest.NewServer(Middleware(testMiddlewareConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(nil, "LoremIpsum123", func(r *http.Request) string {
+		return "user1-login"
+	}, time.Minute)}
+
+	res, err := client.Post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("request was expected to pass the middleware, got status: %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,75 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserAgentSessionId(t *testing.T) {
+	sessionId := "user1-login"
+
+	if UserAgentSessionId(sessionId, "Firefox") != UserAgentSessionId(sessionId, "Firefox") {
+		t.Errorf("sessionId was expected to be stable for the same User-Agent")
+	}
+	if UserAgentSessionId(sessionId, "Firefox") == UserAgentSessionId(sessionId, "Chrome") {
+		t.Errorf("sessionId was expected to differ for another User-Agent")
+	}
+	if UserAgentSessionId(sessionId, "") == UserAgentSessionId("user2-login", "") {
+		t.Errorf("sessionId was expected to differ for another session")
+	}
+}
+
+func TestMiddlewareBindUserAgent(t *testing.T) {
+	config := testMiddlewareConfig()
+	config.BindUserAgent = true
+
+	for _, tc := range []struct {
+		issuedTo, submittedFrom string
+		code                    int
+	}{
+		{"Firefox", "Firefox", http.StatusOK},
+		{"Firefox", "Chrome", http.StatusForbidden},
+		{"Firefox", "", http.StatusForbidden},
+		{"", "", http.StatusOK},
+		{"", "Firefox", http.StatusForbidden},
+	} {
+		get := httptest.NewRequest(http.MethodGet, "/", nil)
+		get.Header.Set("User-Agent", tc.issuedTo)
+		_, token := serveMiddleware(config, get)
+
+		post := httptest.NewRequest(http.MethodPost, "/", nil)
+		post.Header.Set("User-Agent", tc.submittedFrom)
+		post.Header.Set("X-CSRF-Token", token)
+		if w, _ := serveMiddleware(config, post); w.Code != tc.code {
+			t.Errorf("token issued to %q and submitted from %q was expected to return %d, got: %d",
+				tc.issuedTo, tc.submittedFrom, tc.code, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CSRF-Token", GenerateToken("user1-login", time.Now().Add(time.Minute), "LoremIpsum123"))
+	if w, _ := serveMiddleware(config, r); w.Code != http.StatusForbidden {
+		t.Errorf("unbound token was expected to be rejected, got: %d", w.Code)
+	}
+}
@@ -0,0 +1,68 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenerateTokenWildcard generates a token valid for every sessionId starting with the namespace, e.g. "user:123:op:"
+// for all operations of the user. See TokenConfig.GenerateTokenWildcard for details.
+func GenerateTokenWildcard(namespace string, expireAt time.Time, secret string) string {
+	return defaultConfig.GenerateTokenWildcard(namespace, expireAt, secret)
+}
+
+// ValidateTokenWildcard checks if the token generated by GenerateTokenWildcard is valid for the sessionId.
+func ValidateTokenWildcard(token, sessionId string, now time.Time, secret string) bool {
+	return defaultConfig.ValidateTokenWildcard(token, sessionId, now, secret)
+}
+
+// GenerateTokenWildcard generates a token valid for every sessionId starting with the namespace.
+// The HMAC covers the namespace, and the token is prefixed with the namespace length, so validation recomputes the
+// namespace from the sessionId and its scope can't be widened. The HMAC input is tagged, see wildcardSession.
+func (c *TokenConfig) GenerateTokenWildcard(namespace string, expireAt time.Time, secret string) string {
+	return strconv.Itoa(len(namespace)) + TokenTimestampSeparator + c.GenerateToken(wildcardSession(namespace), expireAt, secret)
+}
+
+// ValidateTokenWildcard checks if the token generated by GenerateTokenWildcard is valid for the sessionId,
+// i.e. it was generated for a namespace the sessionId starts with.
+func (c *TokenConfig) ValidateTokenWildcard(token, sessionId string, now time.Time, secret string) bool {
+	length, rest, ok := strings.Cut(token, TokenTimestampSeparator)
+	if !ok {
+		return false
+	}
+
+	n, err := strconv.Atoi(length)
+	if err != nil || n < 0 || n > len(sessionId) || strconv.Itoa(n) != length {
+		return false
+	}
+
+	return c.ValidateToken(rest, wildcardSession(sessionId[:n]), now, secret)
+}
+
+// wildcardSession returns the sessionId covered by the HMAC of wildcard tokens for the namespace, prefixed with
+// "wildcard|" and the namespace length. Wildcard and regular tokens are not interchangeable, unless regular sessionIds
+// can start with the tag.
+func wildcardSession(namespace string) string {
+	return string(binary.AppendUvarint([]byte("wildcard|"), uint64(len(namespace)))) + namespace
+}
@@ -0,0 +1,77 @@
+/**
+ * Copyright (c) 2021 Maciej Tarnowski
+ *
+ * Permission is hereby granted, free of charge,
+ * to any person obtaining a copy of this software and associated documentation files (the "Software"),
+ * to deal in the Software without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies
+ * or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE
+ * FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+ * ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package csrf
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWildcardToken(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	token := GenerateTokenWildcard("user:123:op:", now.Add(time.Minute), secret)
+
+	for _, sessionId := range []string{"user:123:op:delete", "user:123:op:edit", "user:123:op:"} {
+		if !ValidateTokenWildcard(token, sessionId, now, secret) {
+			t.Errorf("token was expected to be valid for sessionId in the namespace: %s", sessionId)
+		}
+	}
+	for _, sessionId := range []string{"user:124:op:delete", "user:123:admin:delete", "user:123:op", ""} {
+		if ValidateTokenWildcard(token, sessionId, now, secret) {
+			t.Errorf("token was expected to be invalid for sessionId outside the namespace: %s", sessionId)
+		}
+	}
+	if ValidateTokenWildcard(token, "user:123:op:delete", now.Add(2*time.Minute), secret) {
+		t.Errorf("token was expected to be expired")
+	}
+}
+
+func TestWildcardTokenScopeCantBeWidened(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	token := GenerateTokenWildcard("user:123:op:", now.Add(time.Minute), secret)
+	_, rest, _ := strings.Cut(token, TokenTimestampSeparator)
+
+	for _, length := range []string{"5", "9", "11", "012", "-1"} {
+		if ValidateTokenWildcard(length+TokenTimestampSeparator+rest, "user:123:op:delete", now, secret) {
+			t.Errorf("token with namespace length %s was expected to be invalid", length)
+		}
+	}
+}
+
+func TestWildcardAndRegularTokensAreNotInterchangeable(t *testing.T) {
+	secret := "LoremIpsum123"
+	now := time.Now()
+
+	wildcard := GenerateTokenWildcard("user:123:op:", now.Add(time.Minute), secret)
+	_, rest, _ := strings.Cut(wildcard, TokenTimestampSeparator)
+	if ValidateToken(rest, "user:123:op:", now, secret) || ValidateToken(wildcard, "user:123:op:", now, secret) {
+		t.Errorf("wildcard token was expected to be invalid as regular token")
+	}
+
+	regular := GenerateToken("user:123:op:", now.Add(time.Minute), secret)
+	if ValidateTokenWildcard("12"+TokenTimestampSeparator+regular, "user:123:op:delete", now, secret) {
+		t.Errorf("regular token was expected to be invalid as wildcard token")
+	}
+}